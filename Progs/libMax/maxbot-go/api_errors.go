@@ -0,0 +1,121 @@
+package maxbot
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sentinel errors matched by *APIError through errors.Is, so they work
+// through any amount of wrapping:
+//
+//	if errors.Is(err, maxbot.ErrBlockedByUser) { ... }
+var (
+	ErrForbidden      = errors.New("forbidden")
+	ErrNotFound       = errors.New("not found")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrBlockedByUser  = errors.New("bot blocked by user")
+	ErrMessageTooLong = errors.New("message too long")
+)
+
+// MAX error codes per class. Codes are matched case-insensitively; the
+// HTTP status is used when the code is unknown.
+var (
+	forbiddenCodes      = []string{"access.denied", "chat.denied", "forbidden"}
+	notFoundCodes       = []string{"not.found", "chat.not.found", "message.not.found", "user.not.found"}
+	rateLimitedCodes    = []string{"too.many.requests", "rate.limit.exceeded"}
+	blockedByUserCodes  = []string{"bot.blocked", "user.blocked", "dialog.suspended"}
+	messageTooLongCodes = []string{"text.too.long", "message.too.long"}
+)
+
+// Is reports whether e belongs to the class of a sentinel error.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden || e.hasCode(forbiddenCodes) || e.blockedByUser()
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.hasCode(notFoundCodes)
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || e.hasCode(rateLimitedCodes)
+	case ErrBlockedByUser:
+		return e.blockedByUser()
+	case ErrMessageTooLong:
+		return e.hasCode(messageTooLongCodes) ||
+			(e.StatusCode == http.StatusBadRequest && e.mentions("too long"))
+	}
+	return false
+}
+
+// Temporary reports whether repeating the request may succeed: 429, 408
+// and 5xx responses.
+func (e *APIError) Temporary() bool {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode == http.StatusRequestTimeout:
+		return true
+	case e.StatusCode >= http.StatusInternalServerError:
+		return true
+	}
+	return e.hasCode(rateLimitedCodes)
+}
+
+// blockedByUser matches the dedicated codes and 403 chat.denied responses
+// whose message says the dialog is blocked or suspended.
+func (e *APIError) blockedByUser() bool {
+	if e.hasCode(blockedByUserCodes) {
+		return true
+	}
+	denied := e.StatusCode == http.StatusForbidden || e.hasCode(forbiddenCodes)
+	return denied && (e.mentions("blocked") || e.mentions("suspended"))
+}
+
+func (e *APIError) hasCode(codes []string) bool {
+	for _, code := range codes {
+		if strings.EqualFold(e.Code, code) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *APIError) mentions(s string) bool {
+	return strings.Contains(strings.ToLower(e.Message+" "+e.Description), s)
+}
+
+// IsForbidden reports whether err is an API error for a denied action.
+func IsForbidden(err error) bool { return errors.Is(err, ErrForbidden) }
+
+// IsNotFound reports whether err is an API error for a missing chat, message
+// or user.
+func IsNotFound(err error) bool { return errors.Is(err, ErrNotFound) }
+
+// IsRateLimited reports whether err is a 429 API error.
+func IsRateLimited(err error) bool { return errors.Is(err, ErrRateLimited) }
+
+// IsBlockedByUser reports whether err means the user blocked the bot.
+func IsBlockedByUser(err error) bool { return errors.Is(err, ErrBlockedByUser) }
+
+// IsMessageTooLong reports whether err means the message text exceeds the
+// API limit.
+func IsMessageTooLong(err error) bool { return errors.Is(err, ErrMessageTooLong) }
+
+// IsRetryable reports whether repeating the failed call may succeed: a
+// temporary API error or a transport failure. Context errors and
+// ErrCircuitOpen are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || isContextError(err) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	return isConnectionError(err) || isTransportError(err)
+}
+
+// isTransportError reports whether err came from the HTTP round trip rather
+// than from the API or the caller.
+func isTransportError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
@@ -0,0 +1,91 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAPIErrorClassification(t *testing.T) {
+	cases := []struct {
+		name      string
+		status    int
+		body      string
+		forbidden bool
+		notFound  bool
+		limited   bool
+		blocked   bool
+		tooLong   bool
+		retryable bool
+	}{
+		{name: "blocked by user", status: 403, body: `{"code":"chat.denied","message":"chat.denied: dialog.suspended, bot blocked by user"}`, forbidden: true, blocked: true},
+		{name: "blocked code", status: 400, body: `{"code":"bot.blocked"}`, forbidden: true, blocked: true},
+		{name: "plain forbidden", status: 403, body: `{"code":"access.denied","message":"not an admin"}`, forbidden: true},
+		{name: "chat not found", status: 404, body: `{"code":"chat.not.found","message":"Chat 1 not found"}`, notFound: true},
+		{name: "not found code", status: 400, body: `{"code":"not.found"}`, notFound: true},
+		{name: "message too long", status: 400, body: `{"code":"proto.payload","message":"text: size must be less than 4000, too long"}`, tooLong: true},
+		{name: "too long code", status: 400, body: `{"code":"text.too.long"}`, tooLong: true},
+		{name: "rate limited", status: 429, body: `{"code":"too.many.requests"}`, limited: true, retryable: true},
+		{name: "server error", status: 502, body: `bad gateway`, retryable: true},
+		{name: "bad request", status: 400, body: `{"code":"proto.payload"}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiErr := parseAPIError(tc.status, "", []byte(tc.body))
+			err := fmt.Errorf("send reply: %w", fmt.Errorf("chat 1: %w", apiErr))
+			checks := []struct {
+				name string
+				got  bool
+				want bool
+			}{
+				{"IsForbidden", IsForbidden(err), tc.forbidden},
+				{"IsNotFound", IsNotFound(err), tc.notFound},
+				{"IsRateLimited", IsRateLimited(err), tc.limited},
+				{"IsBlockedByUser", IsBlockedByUser(err), tc.blocked},
+				{"IsMessageTooLong", IsMessageTooLong(err), tc.tooLong},
+				{"IsRetryable", IsRetryable(err), tc.retryable},
+				{"Temporary", apiErr.Temporary(), tc.retryable},
+			}
+			for _, c := range checks {
+				if c.got != c.want {
+					t.Fatalf("%s = %v, want %v for %v", c.name, c.got, c.want, err)
+				}
+			}
+			var asErr *APIError
+			if !errors.As(err, &asErr) || asErr.StatusCode != tc.status {
+				t.Fatalf("expected errors.As to reach the APIError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsRetryableNonAPIErrors(t *testing.T) {
+	transport := fmt.Errorf("request failed: %w", &url.Error{Op: "Get", URL: "http://x", Err: errors.New("connection reset by peer")})
+	if !IsRetryable(transport) {
+		t.Fatal("expected transport errors to be retryable")
+	}
+	for _, err := range []error{
+		nil,
+		context.Canceled,
+		fmt.Errorf("%w: GET /updates", ErrCircuitOpen),
+		errors.New("encode payload"),
+	} {
+		if IsRetryable(err) {
+			t.Fatalf("expected %v not to be retryable", err)
+		}
+	}
+}
+
+func TestRetryUsesTemporaryForCodeOnlyRateLimit(t *testing.T) {
+	apiErr := &APIError{StatusCode: http.StatusBadRequest, Code: "too.many.requests"}
+	policy := DefaultRetryPolicy{MaxRetries: 1}
+	if _, ok := policy.Retry(RetryRequest{Method: http.MethodPost, Path: "/messages"}, apiErr); !ok {
+		t.Fatal("expected rate-limit code to be retried like a 429")
+	}
+	if _, ok := policy.Retry(RetryRequest{Method: http.MethodGet, Path: "/me"}, &APIError{StatusCode: http.StatusForbidden}); ok {
+		t.Fatal("expected 403 not to be retried")
+	}
+}
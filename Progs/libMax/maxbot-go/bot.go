@@ -2,11 +2,14 @@ package maxbot
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,13 +18,56 @@ type PollingOptions struct {
 	Limit          int
 	TimeoutSeconds int
 	IdleDelay      time.Duration
+	// OnActiveWebhook decides what StartLongPolling does when a webhook
+	// subscription exists. The default ignores subscriptions.
+	OnActiveWebhook ActiveWebhookPolicy
 }
 
+const defaultWebhookMaxBodyBytes = 1 << 20
+
 type WebhookOptions struct {
 	Addr              string
 	Path              string
 	ReadHeaderTimeout time.Duration
 	ShutdownTimeout   time.Duration
+	// MaxBodyBytes caps the update payload size; larger bodies get 413.
+	// Defaults to 1 MiB.
+	MaxBodyBytes int64
+	// Secret must match the X-Max-Bot-Api-Secret header; requests without it
+	// get 401.
+	Secret string
+	// AllowedIPs restricts callers to these IPs or CIDR ranges; others get 403.
+	AllowedIPs []string
+	// TrustedProxies are IPs or CIDR ranges whose X-Forwarded-For header is
+	// used to find the original caller for AllowedIPs.
+	TrustedProxies []string
+	// TLSCertFile and TLSKeyFile enable HTTPS; the pair is reloaded when
+	// either file changes on disk.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSConfig enables HTTPS with a caller-provided configuration. It is
+	// cloned; TLSCertFile/TLSKeyFile take precedence for certificates.
+	TLSConfig *tls.Config
+	// SelfSignedTLS serves HTTPS with a generated certificate when no other
+	// certificate is configured. Intended for development only.
+	SelfSignedTLS bool
+	// HandleInBackground acknowledges valid updates with 200 immediately and
+	// dispatches them on a worker pool. Updates of one chat are processed in
+	// order. When the queue is full the webhook answers 503 so MAX retries.
+	HandleInBackground bool
+	// BackgroundWorkers and BackgroundQueueSize bound the pool (defaults 4
+	// and 256).
+	BackgroundWorkers   int
+	BackgroundQueueSize int
+	// OnDispatchError is called for updates whose dispatch failed.
+	OnDispatchError func(err error, upd Update)
+	// PublicURL, when set, is registered as a MAX subscription (with Secret
+	// and UpdateTypes) before the server starts.
+	PublicURL   string
+	UpdateTypes []string
+	// UnsubscribeOnShutdown removes the PublicURL subscription on shutdown.
+	// Leave it off for rolling deploys where the next instance keeps the URL.
+	UnsubscribeOnShutdown bool
 }
 
 type BotOption func(*Bot)
@@ -31,6 +77,18 @@ type Bot struct {
 	router  *Router
 	polling PollingOptions
 	logger  Logger
+
+	poolsMu sync.Mutex
+	pools   []*dispatchPool
+
+	shutdownMu    sync.Mutex
+	shutdown      *shutdownState
+	shutdownGrace time.Duration
+
+	errorHooks          []func(error, Update)
+	startupHooks        []LifecycleHook
+	shutdownHooks       []LifecycleHook
+	shutdownHookTimeout time.Duration
 }
 
 func NewBot(client *Client, opts ...BotOption) *Bot {
@@ -42,7 +100,11 @@ func NewBot(client *Client, opts ...BotOption) *Bot {
 			TimeoutSeconds: 25,
 			IdleDelay:      400 * time.Millisecond,
 		},
-		logger: NopLogger{},
+		logger:        NopLogger{},
+		shutdown:      newShutdownState(),
+		shutdownGrace: defaultShutdownGrace,
+
+		shutdownHookTimeout: defaultShutdownHookTimeout,
 	}
 	for _, opt := range opts {
 		opt(b)
@@ -72,6 +134,7 @@ func WithPolling(opts PollingOptions) BotOption {
 		if opts.IdleDelay > 0 {
 			b.polling.IdleDelay = opts.IdleDelay
 		}
+		b.polling.OnActiveWebhook = opts.OnActiveWebhook
 	}
 }
 
@@ -91,43 +154,124 @@ func (b *Bot) HandleCallback(handler Handler) {
 	b.router.HandleCallback(handler)
 }
 
+func (b *Bot) HandleCallbackPrefix(prefix string, handler Handler) {
+	b.router.HandleCallbackPrefix(prefix, handler)
+}
+
+// OnError registers a hook for failed dispatches, including
+// *DispatchTimeoutError, in both runtimes.
+func (b *Bot) OnError(hook func(err error, upd Update)) {
+	if hook != nil {
+		b.errorHooks = append(b.errorHooks, hook)
+	}
+}
+
+func (b *Bot) reportError(err error, upd Update) {
+	for _, hook := range b.errorHooks {
+		hook(err, upd)
+	}
+}
+
+// StartLongPolling fetches and dispatches updates until ctx is cancelled or
+// Shutdown is called. On cancellation it stops fetching, lets running
+// handlers finish within the shutdown grace period and returns ctx.Err().
 func (b *Bot) StartLongPolling(ctx context.Context) error {
+	return b.startLongPolling(ctx, b.shutdownGrace)
+}
+
+// startLongPolling polls until ctx is done or Shutdown is called, allowing
+// running handlers grace to finish after ctx is cancelled.
+func (b *Bot) startLongPolling(ctx context.Context, grace time.Duration) error {
 	if b.client == nil {
 		return errors.New("bot client is nil")
 	}
+	if err := b.checkActiveWebhook(ctx); err != nil {
+		return err
+	}
+	if err := b.runStartupHooks(ctx); err != nil {
+		return err
+	}
+	s := b.beginRun()
+
+	// Handlers keep running after ctx is cancelled; they are cancelled by
+	// Shutdown once the grace period expires.
+	handlerCtx := context.WithoutCancel(ctx)
+	pollCtx, cancelPoll := context.WithCancel(ctx)
+	defer cancelPoll()
+	stopPoll := context.AfterFunc(s.stopCtx, cancelPoll)
+	defer stopPoll()
+	stopOnCancel := context.AfterFunc(ctx, s.stop)
+	defer stopOnCancel()
+
+	err := b.pollLoop(pollCtx, handlerCtx, s)
+	if ctx.Err() != nil {
+		b.logger.Infof("long polling stopped: context done")
+		graceCtx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		_ = b.Shutdown(graceCtx)
+		_ = b.runShutdownHooks()
+		return ctx.Err()
+	}
+	if s.stopping() {
+		b.logger.Infof("long polling stopped: shutdown")
+		err = nil
+	}
+	if hookErr := b.runShutdownHooks(); err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+func (b *Bot) pollLoop(pollCtx, handlerCtx context.Context, s *shutdownState) error {
+	// The loop counts as active so Shutdown waits for the current batch.
+	s.active.add()
+	defer s.active.done()
+
 	b.logger.Infof("long polling started")
 	offset := b.polling.Offset
-	for {
-		select {
-		case <-ctx.Done():
-			b.logger.Infof("long polling stopped: context done")
-			return ctx.Err()
-		default:
-		}
-
-		updates, err := b.client.GetUpdates(ctx, GetUpdatesOptions{
+	for pollCtx.Err() == nil {
+		updates, err := b.client.GetUpdates(pollCtx, GetUpdatesOptions{
 			Offset:  offset,
 			Limit:   b.polling.Limit,
 			Timeout: b.polling.TimeoutSeconds,
 		})
 		if err != nil {
+			if pollCtx.Err() != nil {
+				return nil
+			}
 			b.logger.Errorf("long polling get updates failed: %v", err)
 			return err
 		}
 		if len(updates) == 0 {
-			time.Sleep(b.polling.IdleDelay)
+			_ = sleepWithContext(pollCtx, b.polling.IdleDelay)
 			continue
 		}
-		for _, upd := range updates {
+		for i, upd := range updates {
+			if s.abortCtx.Err() != nil {
+				s.aborted.Add(int64(len(updates) - i))
+				return nil
+			}
 			if upd.UpdateID >= offset {
 				offset = upd.UpdateID + 1
 			}
-			if err := b.router.Dispatch(ctx, b.client, upd); err != nil {
+			if err := b.dispatch(handlerCtx, upd); err != nil {
 				b.logger.Errorf("long polling dispatch failed: %v", err)
+				b.reportError(err, upd)
+				// A timed-out handler only affects its own update; keep
+				// polling so one hung handler cannot stop the bot.
+				var timeoutErr *DispatchTimeoutError
+				if errors.As(err, &timeoutErr) {
+					continue
+				}
+				// The rest of the batch is never dispatched.
+				if s.stopping() {
+					s.aborted.Add(int64(len(updates) - i - 1))
+				}
 				return err
 			}
 		}
 	}
+	return nil
 }
 
 func (b *Bot) StartWebhook(ctx context.Context, opts WebhookOptions) error {
@@ -153,63 +297,232 @@ func (b *Bot) StartWebhook(ctx context.Context, opts WebhookOptions) error {
 	}
 	shutdownTimeout := opts.ShutdownTimeout
 	if shutdownTimeout <= 0 {
-		shutdownTimeout = 5 * time.Second
+		shutdownTimeout = b.shutdownGrace
+	}
+
+	s := b.beginRun()
+	// Validate the options up front but only build the handler, and with it
+	// any background workers, once the listener and subscription are up.
+	auth, err := newWebhookAuth(opts, b.logger)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := webhookTLSConfig(opts, b.logger)
+	if err != nil {
+		return err
+	}
+	if err := b.runStartupHooks(ctx); err != nil {
+		return err
+	}
+	// Bind before subscribing so MAX is never pointed at a port we failed
+	// to open.
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		_ = b.runShutdownHooks()
+		b.logger.Errorf("webhook listen on %s failed: %v", addr, err)
+		return fmt.Errorf("webhook listen: %w", err)
+	}
+	publicURL, err := b.subscribeWebhook(ctx, opts)
+	if err != nil {
+		ln.Close()
+		_ = b.runShutdownHooks()
+		return err
 	}
 
 	mux := http.NewServeMux()
-	mux.Handle(path, b.webhookHandler())
+	mux.Handle(path, b.mountWebhook(s, opts, auth))
 
 	server := &http.Server{
 		Addr:              addr,
 		Handler:           mux,
 		ReadHeaderTimeout: readHeaderTimeout,
+		TLSConfig:         tlsConfig,
 	}
 
+	serveFailed := make(chan struct{})
+	shutdownDone := make(chan struct{})
 	go func() {
-		<-ctx.Done()
+		defer close(shutdownDone)
+		select {
+		case <-ctx.Done():
+		case <-s.stopCtx.Done():
+		case <-serveFailed:
+		}
 		b.logger.Infof("webhook shutdown started")
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
-		_ = server.Shutdown(shutdownCtx)
+		go func() {
+			// Stop accepting requests right away; in-flight ones are
+			// awaited by Shutdown below.
+			_ = server.Shutdown(shutdownCtx)
+		}()
+		if err := b.Shutdown(shutdownCtx); err != nil {
+			b.logger.Errorf("webhook shutdown aborted in-flight updates: %v", err)
+		}
+		if publicURL != "" && opts.UnsubscribeOnShutdown {
+			b.unsubscribeWebhook(context.Background(), publicURL)
+		}
 	}()
 
-	b.logger.Infof("webhook server listening on %s%s", addr, path)
-	err := server.ListenAndServe()
+	if tlsConfig != nil {
+		b.logger.Infof("webhook server listening on %s%s (tls)", ln.Addr(), path)
+		err = server.ServeTLS(ln, "", "")
+	} else {
+		b.logger.Infof("webhook server listening on %s%s", ln.Addr(), path)
+		err = server.Serve(ln)
+	}
 	if errors.Is(err, http.ErrServerClosed) {
+		<-shutdownDone
 		b.logger.Infof("webhook server stopped")
-		return nil
+		return b.runShutdownHooks()
+	}
+	// Serving failed: run the regular shutdown (drain background workers,
+	// unsubscribe) before reporting the error.
+	b.logger.Errorf("webhook server failed: %v", err)
+	close(serveFailed)
+	<-shutdownDone
+	_ = b.runShutdownHooks()
+	return fmt.Errorf("webhook server failed: %w", err)
+}
+
+// WebhookHandler returns the webhook endpoint as an http.Handler for mounting
+// into an existing server. It applies the authentication and payload limits
+// from opts; Addr, Path and the timeouts are only used by StartWebhook.
+func (b *Bot) WebhookHandler(opts WebhookOptions) (http.Handler, error) {
+	if b.client == nil {
+		return nil, errors.New("bot client is nil")
 	}
+	s := b.beginRun()
+	auth, err := newWebhookAuth(opts, b.logger)
 	if err != nil {
-		b.logger.Errorf("webhook server failed: %v", err)
-		return fmt.Errorf("webhook server failed: %w", err)
+		return nil, err
 	}
-	return nil
+	return b.mountWebhook(s, opts, auth), nil
 }
 
-func (b *Bot) webhookHandler() http.Handler {
+// mountWebhook builds the webhook endpoint for run s. With
+// HandleInBackground it starts a worker pool and registers it for
+// DrainWebhook, so callers must only mount once nothing else can fail.
+func (b *Bot) mountWebhook(s *shutdownState, opts WebhookOptions, auth *webhookAuth) http.Handler {
+	maxBodyBytes := opts.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultWebhookMaxBodyBytes
+	}
+	onError := func(err error, upd Update) {
+		b.logger.Errorf("webhook dispatch failed: update_id=%d: %v", upd.UpdateID, err)
+		b.reportError(err, upd)
+		if opts.OnDispatchError != nil {
+			opts.OnDispatchError(err, upd)
+		}
+	}
+	if opts.HandleInBackground {
+		pool := newDispatchPool(opts.BackgroundWorkers, opts.BackgroundQueueSize, func(ctx context.Context, upd Update) error {
+			if err := ctx.Err(); err != nil {
+				s.aborted.Add(1)
+				return err
+			}
+			return b.dispatch(ctx, upd)
+		}, onError)
+		b.poolsMu.Lock()
+		b.pools = append(b.pools, pool)
+		b.poolsMu.Unlock()
+		return auth.wrap(b.backgroundWebhookHandler(s, maxBodyBytes, pool))
+	}
+	return auth.wrap(b.webhookHandler(s, maxBodyBytes, onError))
+}
+
+// DrainWebhook stops background webhook workers after processing queued
+// updates. StartWebhook calls it on shutdown; call it yourself when serving
+// a background WebhookHandler from your own server.
+func (b *Bot) DrainWebhook(ctx context.Context) error {
+	b.poolsMu.Lock()
+	pools := b.pools
+	b.pools = nil
+	b.poolsMu.Unlock()
+
+	var errs []error
+	for _, pool := range pools {
+		if err := pool.Drain(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Bot) webhookHandler(s *shutdownState, maxBodyBytes int64, onError func(error, Update)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		defer r.Body.Close()
-		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
-		var upd Update
-		if err := dec.Decode(&upd); err != nil {
-			b.logger.Errorf("webhook invalid payload: %v", err)
-			http.Error(w, "invalid update payload", http.StatusBadRequest)
+		if s.stopping() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		upd, ok := b.decodeWebhookUpdate(w, r, maxBodyBytes)
+		if !ok {
 			return
 		}
 
-		if err := b.router.Dispatch(r.Context(), b.client, upd); err != nil {
-			b.logger.Errorf("webhook dispatch failed: %v", err)
+		if err := b.dispatch(r.Context(), upd); err != nil {
+			if onError != nil {
+				onError(err, upd)
+			}
 			http.Error(w, "failed to dispatch update", http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`{"ok":true}`))
+		writeWebhookOK(w)
 	})
 }
+
+func (b *Bot) backgroundWebhookHandler(s *shutdownState, maxBodyBytes int64, pool *dispatchPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if s.stopping() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		upd, ok := b.decodeWebhookUpdate(w, r, maxBodyBytes)
+		if !ok {
+			return
+		}
+
+		if !pool.Enqueue(upd) {
+			b.logger.Errorf("webhook background queue full or closed: update_id=%d", upd.UpdateID)
+			http.Error(w, "update queue is full", http.StatusServiceUnavailable)
+			return
+		}
+
+		writeWebhookOK(w)
+	})
+}
+
+func (b *Bot) decodeWebhookUpdate(w http.ResponseWriter, r *http.Request, maxBodyBytes int64) (Update, bool) {
+	defer r.Body.Close()
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	var upd Update
+	if err := dec.Decode(&upd); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			b.logger.Errorf("webhook payload too large: %v", err)
+			http.Error(w, "update payload too large", http.StatusRequestEntityTooLarge)
+			return Update{}, false
+		}
+		b.logger.Errorf("webhook invalid payload: %v", err)
+		http.Error(w, "invalid update payload", http.StatusBadRequest)
+		return Update{}, false
+	}
+	return upd, true
+}
+
+func writeWebhookOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
@@ -0,0 +1,77 @@
+package maxbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Do performs a raw API call for endpoints the client does not wrap yet.
+// path is relative to the base URL and may include a query string; a
+// non-nil payload is sent as JSON. The request goes through the same auth,
+// rate limiting, retries, circuit breaker and middleware as typed methods,
+// and error responses are returned as *APIError.
+func (c *Client) Do(ctx context.Context, method, path string, payload any) ([]byte, error) {
+	if strings.TrimSpace(method) == "" {
+		return nil, fmt.Errorf("do: method is required")
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("do: path must start with /, got %q", path)
+	}
+	if isNilPayload(payload) {
+		payload = nil
+	}
+	return c.do(withRoute(ctx, rawRoute(path)), strings.ToUpper(method), path, payload)
+}
+
+// Call is the typed form of Client.Do: req is sent as the JSON body and
+// the response is decoded into Resp. Use a struct without fields (struct{},
+// a named empty struct or a pointer to one) as Req for calls without a body
+// and as Resp to ignore the response.
+//
+//	chat, err := maxbot.Call[struct{}, Chat](ctx, client, http.MethodGet, "/chats/42", struct{}{})
+func Call[Req, Resp any](ctx context.Context, c *Client, method, path string, req Req) (Resp, error) {
+	var out Resp
+	var payload any = req
+	if isEmptyStruct(reflect.TypeOf(payload)) {
+		payload = nil
+	}
+	body, err := c.Do(ctx, method, path, payload)
+	if err != nil {
+		return out, err
+	}
+	if isEmptyStruct(reflect.TypeFor[Resp]()) || len(bytes.TrimSpace(body)) == 0 {
+		return out, nil
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return out, fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return out, nil
+}
+
+// isEmptyStruct reports whether t is a struct without fields or a pointer
+// to one.
+func isEmptyStruct(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t.NumField() == 0
+}
+
+func isNilPayload(payload any) bool {
+	if payload == nil {
+		return true
+	}
+	v := reflect.ValueOf(payload)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallTypedRequestAndResponse(t *testing.T) {
+	type pinRequest struct {
+		MessageID string `json:"message_id"`
+		Notify    bool   `json:"notify"`
+	}
+	type pinResponse struct {
+		Success bool `json:"success"`
+	}
+	var gotMethod, gotPath, gotAuth, gotBody, gotType string
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		gotMethod, gotPath, gotAuth, gotBody = r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(raw)
+		gotType = r.Header.Get("Content-Type")
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}, ClientConfig{})
+	resp, err := Call[pinRequest, pinResponse](context.Background(), c, http.MethodPut, "/chats/42/pin", pinRequest{MessageID: "m1", Notify: true})
+	if err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if !resp.Success {
+		t.Fatalf("expected decoded response, got %+v", resp)
+	}
+	if gotMethod != http.MethodPut || gotPath != "/chats/42/pin" || gotAuth != "test-token" || gotType != "application/json" {
+		t.Fatalf("unexpected request: %s %s auth=%q type=%q", gotMethod, gotPath, gotAuth, gotType)
+	}
+	if gotBody != "{\"message_id\":\"m1\",\"notify\":true}\n" {
+		t.Fatalf("unexpected body %q", gotBody)
+	}
+
+	if _, err := Call[struct{}, Chat](context.Background(), c, http.MethodGet, "/chats/42?fields=title", struct{}{}); err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if gotBody != "" || gotType != "" || gotPath != "/chats/42?fields=title" {
+		t.Fatalf("expected GET without body, got body=%q type=%q path=%q", gotBody, gotType, gotPath)
+	}
+}
+
+func TestCallRetriesAndReturnsAPIError(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code":"chat.not.found","message":"no chat"}`))
+	}, ClientConfig{MaxRetries: 2, InitialBackoff: time.Millisecond})
+	_, err := Call[struct{}, Chat](context.Background(), c, http.MethodGet, "/chats/1", struct{}{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsNotFound(err) || apiErr.Code != "chat.not.found" {
+		t.Fatalf("expected not-found APIError, got %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected one retry after 503, got %d calls", got)
+	}
+}
+
+func TestDoReturnsRawBody(t *testing.T) {
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodDelete || len(raw) != 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"raw":1}`))
+	}, ClientConfig{})
+	var nilPayload *SendMessageRequest
+	body, err := c.Do(context.Background(), "delete", "/chats/1/members/me", nilPayload)
+	if err != nil {
+		t.Fatalf("Do error: %v", err)
+	}
+	if string(body) != `{"raw":1}` {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if _, err := c.Do(context.Background(), http.MethodGet, "chats", nil); err == nil {
+		t.Fatal("expected relative path to be rejected")
+	}
+}
+
+func TestCallTreatsNamedAndPointerEmptyStructsAsNoBody(t *testing.T) {
+	type noContent struct{}
+	var gotBody string
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		gotBody = string(raw)
+		_, _ = w.Write([]byte(`OK`))
+	}, ClientConfig{})
+	ctx := context.Background()
+
+	if _, err := Call[noContent, noContent](ctx, c, http.MethodPost, "/chats/1/pin", noContent{}); err != nil {
+		t.Fatalf("Call with named empty struct error: %v", err)
+	}
+	if gotBody != "" {
+		t.Fatalf("expected no request body, got %q", gotBody)
+	}
+	if _, err := Call[*struct{}, *struct{}](ctx, c, http.MethodDelete, "/chats/1/pin", &struct{}{}); err != nil {
+		t.Fatalf("Call with *struct{} error: %v", err)
+	}
+	if gotBody != "" {
+		t.Fatalf("expected no request body, got %q", gotBody)
+	}
+}
@@ -0,0 +1,435 @@
+package maxbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MaxCallbackDataLength is the maximum callback payload size accepted by MAX.
+const MaxCallbackDataLength = 1024
+
+// ErrInvalidCallbackData reports a callback payload that cannot be unpacked.
+var ErrInvalidCallbackData = errors.New("invalid callback data")
+
+// CallbackData packs struct values into callback payloads and back.
+//
+// The wire format matches maxbot-js createCallbackData:
+// "prefix:key=value:key=value" with URI-component escaping. Field keys come
+// from the `callback` struct tag or default to the lower-cased field name;
+// `callback:"-"` skips a field.
+//
+// With WithCallbackSigning the payload gets a trailing ":~<hmac>" segment and
+// Unpack rejects payloads whose signature does not match. With
+// WithCallbackStore payloads over the length limit are kept server-side and
+// the button carries only "prefix:@<token>".
+type CallbackData[T any] struct {
+	prefix string
+	fields []callbackField
+	key    []byte
+	store  CallbackStore
+}
+
+// CallbackDataOption configures a CallbackData codec.
+type CallbackDataOption func(*callbackDataOptions)
+
+type callbackDataOptions struct {
+	key   []byte
+	store CallbackStore
+	err   error
+}
+
+// WithCallbackSigning signs payloads with HMAC-SHA256 under key. An empty
+// key is rejected by NewCallbackData rather than silently disabling signing.
+func WithCallbackSigning(key []byte) CallbackDataOption {
+	return func(o *callbackDataOptions) {
+		if len(key) == 0 {
+			o.err = errors.New("callback data: signing key is empty")
+			return
+		}
+		o.key = append([]byte(nil), key...)
+	}
+}
+
+// WithCallbackStore keeps payloads longer than MaxCallbackDataLength in store.
+func WithCallbackStore(store CallbackStore) CallbackDataOption {
+	return func(o *callbackDataOptions) {
+		if store != nil {
+			o.store = store
+		}
+	}
+}
+
+type callbackField struct {
+	key   string
+	index []int
+}
+
+// NewCallbackData builds a codec for T, which must be a struct type.
+func NewCallbackData[T any](prefix string, opts ...CallbackDataOption) (*CallbackData[T], error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return nil, errors.New("callback data: prefix is required")
+	}
+	var zero T
+	typ := reflect.TypeOf(zero)
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("callback data: %v is not a struct type", typ)
+	}
+
+	var o callbackDataOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+
+	cd := &CallbackData[T]{prefix: escapeCallbackPart(prefix), key: o.key, store: o.store}
+	seen := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := strings.ToLower(sf.Name)
+		if tag, ok := sf.Tag.Lookup("callback"); ok {
+			tag = strings.TrimSpace(tag)
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				key = tag
+			}
+		}
+		if !isCallbackFieldType(sf.Type) {
+			return nil, fmt.Errorf("callback data: field %s has unsupported type %v", sf.Name, sf.Type)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("callback data: duplicate key %q", key)
+		}
+		seen[key] = true
+		cd.fields = append(cd.fields, callbackField{key: key, index: sf.Index})
+	}
+	return cd, nil
+}
+
+// MustCallbackData is like NewCallbackData but panics on error.
+func MustCallbackData[T any](prefix string, opts ...CallbackDataOption) *CallbackData[T] {
+	cd, err := NewCallbackData[T](prefix, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return cd
+}
+
+// Prefix returns the escaped prefix that starts every packed payload.
+func (cd *CallbackData[T]) Prefix() string {
+	return cd.prefix
+}
+
+// Pack encodes v into a callback payload.
+func (cd *CallbackData[T]) Pack(v T) (string, error) {
+	return cd.PackContext(context.Background(), v)
+}
+
+// PackContext is like Pack and passes ctx to the overflow store.
+func (cd *CallbackData[T]) PackContext(ctx context.Context, v T) (string, error) {
+	rv := reflect.ValueOf(v)
+	var sb strings.Builder
+	sb.WriteString(cd.prefix)
+	for _, f := range cd.fields {
+		raw, err := formatCallbackValue(rv.FieldByIndex(f.index))
+		if err != nil {
+			return "", fmt.Errorf("callback data: field %s: %w", f.key, err)
+		}
+		sb.WriteByte(':')
+		sb.WriteString(escapeCallbackPart(f.key))
+		sb.WriteByte('=')
+		sb.WriteString(escapeCallbackPart(raw))
+	}
+	body := sb.String()
+	out := cd.sign(body)
+	if len(out) <= MaxCallbackDataLength {
+		return out, nil
+	}
+	if cd.store == nil {
+		return "", fmt.Errorf("callback data: payload is %d bytes, limit is %d", len(out), MaxCallbackDataLength)
+	}
+	token, err := newCallbackToken()
+	if err != nil {
+		return "", fmt.Errorf("callback data: %w", err)
+	}
+	if err := cd.store.Save(ctx, token, body); err != nil {
+		return "", fmt.Errorf("callback data: store payload: %w", err)
+	}
+	return cd.sign(cd.prefix + ":@" + token), nil
+}
+
+// MustPack is like Pack but panics on error.
+func (cd *CallbackData[T]) MustPack(v T) string {
+	out, err := cd.Pack(v)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Match reports whether raw carries this codec's prefix.
+func (cd *CallbackData[T]) Match(raw string) bool {
+	return matchCallbackPrefix(raw, cd.prefix)
+}
+
+// Unpack decodes raw into a T. Unknown keys are ignored and missing keys
+// leave the zero value, so payloads survive adding fields to T.
+func (cd *CallbackData[T]) Unpack(raw string) (T, error) {
+	return cd.UnpackContext(context.Background(), raw)
+}
+
+// UnpackContext is like Unpack and passes ctx to the overflow store.
+func (cd *CallbackData[T]) UnpackContext(ctx context.Context, raw string) (T, error) {
+	var out T
+	raw = strings.TrimSpace(raw)
+	if !cd.Match(raw) {
+		return out, fmt.Errorf("%w: prefix mismatch", ErrInvalidCallbackData)
+	}
+	body, err := cd.verify(raw)
+	if err != nil {
+		return out, err
+	}
+	if token, ok := strings.CutPrefix(body, cd.prefix+":@"); ok && cd.store != nil {
+		stored, found, err := cd.store.Load(ctx, token)
+		if err != nil {
+			return out, fmt.Errorf("callback data: load payload: %w", err)
+		}
+		if !found || !cd.Match(stored) {
+			return out, fmt.Errorf("%w: unknown or expired token", ErrInvalidCallbackData)
+		}
+		body = stored
+	}
+
+	values := make(map[string]string)
+	for _, item := range strings.Split(body, ":")[1:] {
+		idx := strings.IndexByte(item, '=')
+		if idx <= 0 {
+			continue
+		}
+		key, err := unescapeCallbackPart(item[:idx])
+		if err != nil {
+			return out, fmt.Errorf("%w: %v", ErrInvalidCallbackData, err)
+		}
+		value, err := unescapeCallbackPart(item[idx+1:])
+		if err != nil {
+			return out, fmt.Errorf("%w: %v", ErrInvalidCallbackData, err)
+		}
+		values[key] = value
+	}
+
+	rv := reflect.ValueOf(&out).Elem()
+	for _, f := range cd.fields {
+		value, ok := values[f.key]
+		if !ok {
+			continue
+		}
+		if err := parseCallbackValue(rv.FieldByIndex(f.index), value); err != nil {
+			return out, fmt.Errorf("%w: field %s: %v", ErrInvalidCallbackData, f.key, err)
+		}
+	}
+	return out, nil
+}
+
+func (cd *CallbackData[T]) sign(body string) string {
+	if len(cd.key) == 0 {
+		return body
+	}
+	return body + ":~" + callbackSignature(cd.key, body)
+}
+
+func (cd *CallbackData[T]) verify(raw string) (string, error) {
+	if len(cd.key) == 0 {
+		return raw, nil
+	}
+	idx := strings.LastIndex(raw, ":~")
+	if idx < 0 {
+		return "", fmt.Errorf("%w: missing signature", ErrInvalidCallbackData)
+	}
+	body, sig := raw[:idx], raw[idx+2:]
+	want := callbackSignature(cd.key, body)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return "", fmt.Errorf("%w: bad signature", ErrInvalidCallbackData)
+	}
+	return body, nil
+}
+
+func callbackSignature(key []byte, body string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func newCallbackToken() (string, error) {
+	var buf [12]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+// CallbackRouter is implemented by Router and Bot.
+type CallbackRouter interface {
+	HandleCallbackPrefix(prefix string, handler Handler)
+}
+
+// HandleCallbackData registers a typed callback handler for payloads packed
+// with NewCallbackData[T](prefix, opts...). It panics if T is not a valid
+// payload type. Payloads that match the prefix but fail to unpack or verify
+// are reported as dispatch errors wrapping ErrInvalidCallbackData.
+func HandleCallbackData[T any](r CallbackRouter, prefix string, handler func(*Context, T) error, opts ...CallbackDataOption) {
+	cd := MustCallbackData[T](prefix, opts...)
+	if handler == nil {
+		return
+	}
+	r.HandleCallbackPrefix(cd.prefix, func(c *Context) error {
+		v, err := cd.UnpackContext(c.Context(), c.CallbackData())
+		if err != nil {
+			return err
+		}
+		return handler(c, v)
+	})
+}
+
+func matchCallbackPrefix(raw, prefix string) bool {
+	raw = strings.TrimSpace(raw)
+	return raw == prefix || strings.HasPrefix(raw, prefix+":")
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func isCallbackFieldType(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) && reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func formatCallbackValue(v reflect.Value) (string, error) {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %v", v.Type())
+}
+
+func parseCallbackValue(v reflect.Value, raw string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// escapeCallbackPart mirrors JavaScript encodeURIComponent so payloads are
+// interchangeable with maxbot-js.
+func escapeCallbackPart(s string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if isCallbackUnreserved(ch) {
+			sb.WriteByte(ch)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[ch>>4])
+		sb.WriteByte(hex[ch&0x0f])
+	}
+	return sb.String()
+}
+
+func isCallbackUnreserved(ch byte) bool {
+	switch {
+	case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		return true
+	}
+	return strings.IndexByte("-_.!~*'()", ch) >= 0
+}
+
+func unescapeCallbackPart(s string) (string, error) {
+	if strings.IndexByte(s, '%') < 0 {
+		return s, nil
+	}
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("bad escape in %q", s)
+		}
+		n, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("bad escape in %q", s)
+		}
+		out = append(out, byte(n))
+		i += 2
+	}
+	return string(out), nil
+}
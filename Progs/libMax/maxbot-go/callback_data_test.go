@@ -0,0 +1,226 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type orderAction struct {
+	Action string `callback:"a"`
+	ID     int64  `callback:"id"`
+	Page   int
+	Urgent bool
+	Note   string `callback:"-"`
+}
+
+func TestCallbackDataPackUnpackRoundTrip(t *testing.T) {
+	cd, err := NewCallbackData[orderAction]("order")
+	if err != nil {
+		t.Fatalf("NewCallbackData error: %v", err)
+	}
+
+	raw, err := cd.Pack(orderAction{Action: "approve:now", ID: 123, Page: 2, Urgent: true, Note: "skipped"})
+	if err != nil {
+		t.Fatalf("Pack error: %v", err)
+	}
+	if raw != "order:a=approve%3Anow:id=123:page=2:urgent=true" {
+		t.Fatalf("unexpected payload: %q", raw)
+	}
+
+	got, err := cd.Unpack(raw)
+	if err != nil {
+		t.Fatalf("Unpack error: %v", err)
+	}
+	want := orderAction{Action: "approve:now", ID: 123, Page: 2, Urgent: true}
+	if got != want {
+		t.Fatalf("unexpected unpacked value: %+v", got)
+	}
+}
+
+func TestCallbackDataUnpackRejectsInvalidPayloads(t *testing.T) {
+	cd := MustCallbackData[orderAction]("order")
+
+	cases := []string{
+		"other:id=1",
+		"orders:id=1",
+		"order:id=abc",
+		"order:urgent=maybe",
+		"order:a=%zz",
+	}
+	for _, raw := range cases {
+		if _, err := cd.Unpack(raw); !errors.Is(err, ErrInvalidCallbackData) {
+			t.Fatalf("Unpack(%q) error = %v, want ErrInvalidCallbackData", raw, err)
+		}
+	}
+}
+
+func TestCallbackDataPackEnforcesLengthLimit(t *testing.T) {
+	cd := MustCallbackData[orderAction]("order")
+	_, err := cd.Pack(orderAction{Action: strings.Repeat("x", MaxCallbackDataLength)})
+	if err == nil {
+		t.Fatal("expected length limit error, got nil")
+	}
+}
+
+func TestNewCallbackDataRejectsUnsupportedTypes(t *testing.T) {
+	if _, err := NewCallbackData[string]("p"); err == nil {
+		t.Fatal("expected error for non-struct type")
+	}
+	type withSlice struct {
+		IDs []int
+	}
+	if _, err := NewCallbackData[withSlice]("p"); err == nil {
+		t.Fatal("expected error for slice field")
+	}
+	if _, err := NewCallbackData[orderAction](" "); err == nil {
+		t.Fatal("expected error for empty prefix")
+	}
+	if _, err := NewCallbackData[orderAction]("p", WithCallbackSigning(nil)); err == nil {
+		t.Fatal("expected error for empty signing key")
+	}
+}
+
+func TestHandleCallbackDataDispatchesTypedValue(t *testing.T) {
+	r := NewRouter()
+	var got orderAction
+	fallback := false
+	HandleCallbackData(r, "order", func(c *Context, v orderAction) error {
+		got = v
+		return nil
+	})
+	r.HandleCallback(func(c *Context) error {
+		fallback = true
+		return nil
+	})
+
+	raw := MustCallbackData[orderAction]("order").MustPack(orderAction{Action: "ship", ID: 7})
+	if err := r.Dispatch(context.Background(), nil, Update{Callback: &CallbackQuery{Data: raw}}); err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	if got.Action != "ship" || got.ID != 7 {
+		t.Fatalf("unexpected typed value: %+v", got)
+	}
+	if fallback {
+		t.Fatal("expected typed handler to take precedence over fallback")
+	}
+
+	if err := r.Dispatch(context.Background(), nil, Update{Callback: &CallbackQuery{Data: "plain"}}); err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	if !fallback {
+		t.Fatal("expected fallback handler for unmatched payload")
+	}
+
+	err := r.Dispatch(context.Background(), nil, Update{Callback: &CallbackQuery{Data: "order:id=x"}})
+	if !errors.Is(err, ErrInvalidCallbackData) {
+		t.Fatalf("expected ErrInvalidCallbackData, got %v", err)
+	}
+}
+
+func TestCallbackDataSigningRejectsTamperedPayloads(t *testing.T) {
+	cd := MustCallbackData[orderAction]("order", WithCallbackSigning([]byte("secret")))
+
+	raw := cd.MustPack(orderAction{Action: "approve", ID: 123})
+	if !strings.Contains(raw, ":~") {
+		t.Fatalf("expected signature segment, got %q", raw)
+	}
+	got, err := cd.Unpack(raw)
+	if err != nil {
+		t.Fatalf("Unpack error: %v", err)
+	}
+	if got.ID != 123 {
+		t.Fatalf("unexpected unpacked value: %+v", got)
+	}
+
+	forged := strings.Replace(raw, "id=123", "id=124", 1)
+	if _, err := cd.Unpack(forged); !errors.Is(err, ErrInvalidCallbackData) {
+		t.Fatalf("expected tampered payload to be rejected, got %v", err)
+	}
+	if _, err := cd.Unpack("order:a=approve:id=123"); !errors.Is(err, ErrInvalidCallbackData) {
+		t.Fatalf("expected unsigned payload to be rejected, got %v", err)
+	}
+	other := MustCallbackData[orderAction]("order", WithCallbackSigning([]byte("other")))
+	if _, err := other.Unpack(raw); !errors.Is(err, ErrInvalidCallbackData) {
+		t.Fatalf("expected payload signed with another key to be rejected, got %v", err)
+	}
+}
+
+func TestCallbackDataStoresOverflowPayloads(t *testing.T) {
+	store := NewMemoryCallbackStore(time.Minute)
+	cd := MustCallbackData[orderAction]("order", WithCallbackSigning([]byte("secret")), WithCallbackStore(store))
+
+	long := strings.Repeat("x", MaxCallbackDataLength)
+	raw, err := cd.Pack(orderAction{Action: long, ID: 5})
+	if err != nil {
+		t.Fatalf("Pack error: %v", err)
+	}
+	if len(raw) > MaxCallbackDataLength || !strings.HasPrefix(raw, "order:@") {
+		t.Fatalf("expected short token payload, got %q", raw)
+	}
+
+	got, err := cd.Unpack(raw)
+	if err != nil {
+		t.Fatalf("Unpack error: %v", err)
+	}
+	if got.Action != long || got.ID != 5 {
+		t.Fatalf("unexpected unpacked value: %+v", got)
+	}
+
+	short := cd.MustPack(orderAction{Action: "a", ID: 1})
+	if strings.Contains(short, ":@") {
+		t.Fatalf("expected inline payload below limit, got %q", short)
+	}
+
+	unknown := MustCallbackData[orderAction]("order", WithCallbackStore(store))
+	if _, err := unknown.Unpack("order:@missing"); !errors.Is(err, ErrInvalidCallbackData) {
+		t.Fatalf("expected unknown token to be rejected, got %v", err)
+	}
+}
+
+func TestMemoryCallbackStoreSweepsExpiredEntriesAtThreshold(t *testing.T) {
+	store := NewMemoryCallbackStore(time.Millisecond)
+	ctx := context.Background()
+	for i := 0; i < minCallbackStoreSweep; i++ {
+		_ = store.Save(ctx, strconv.Itoa(i), "p")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	_ = store.Save(ctx, "fresh", "p")
+	store.mu.Lock()
+	n := len(store.entries)
+	store.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected expired entries to be swept, %d left", n)
+	}
+}
+
+func TestDispatchRejectsTamperedSignedCallback(t *testing.T) {
+	key := []byte("secret")
+	r := NewRouter()
+	called := false
+	HandleCallbackData(r, "order", func(c *Context, v orderAction) error {
+		called = true
+		return nil
+	}, WithCallbackSigning(key))
+
+	raw := MustCallbackData[orderAction]("order", WithCallbackSigning(key)).MustPack(orderAction{ID: 1})
+	forged := strings.Replace(raw, "id=1", "id=2", 1)
+	err := r.Dispatch(context.Background(), nil, Update{Callback: &CallbackQuery{Data: forged}})
+	if !errors.Is(err, ErrInvalidCallbackData) {
+		t.Fatalf("expected ErrInvalidCallbackData, got %v", err)
+	}
+	if called {
+		t.Fatal("expected handler not to run for tampered payload")
+	}
+
+	if err := r.Dispatch(context.Background(), nil, Update{Callback: &CallbackQuery{Data: raw}}); err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	if !called {
+		t.Fatal("expected handler to run for valid payload")
+	}
+}
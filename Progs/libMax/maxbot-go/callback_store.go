@@ -0,0 +1,79 @@
+package maxbot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCallbackStoreTTL = 24 * time.Hour
+	// minCallbackStoreSweep is the entry count below which Save never sweeps.
+	minCallbackStoreSweep = 1024
+)
+
+// CallbackStore keeps oversized callback payloads server-side under a token.
+type CallbackStore interface {
+	Save(ctx context.Context, token, payload string) error
+	Load(ctx context.Context, token string) (payload string, ok bool, err error)
+}
+
+// MemoryCallbackStore is an in-process CallbackStore with per-entry expiry.
+type MemoryCallbackStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]callbackStoreEntry
+	// sweepAt is the size at which Save next drops expired entries. It is
+	// reset to twice the surviving count, so sweeping stays amortised O(1).
+	sweepAt int
+}
+
+type callbackStoreEntry struct {
+	payload string
+	expires time.Time
+}
+
+// NewMemoryCallbackStore creates a store whose entries live for ttl
+// (24h when ttl <= 0).
+func NewMemoryCallbackStore(ttl time.Duration) *MemoryCallbackStore {
+	if ttl <= 0 {
+		ttl = defaultCallbackStoreTTL
+	}
+	return &MemoryCallbackStore{
+		ttl:     ttl,
+		entries: make(map[string]callbackStoreEntry),
+		sweepAt: minCallbackStoreSweep,
+	}
+}
+
+func (s *MemoryCallbackStore) Save(_ context.Context, token, payload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.entries) >= s.sweepAt {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.sweepAt = max(2*len(s.entries), minCallbackStoreSweep)
+	}
+	s.entries[token] = callbackStoreEntry{payload: payload, expires: now.Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryCallbackStore) Load(_ context.Context, token string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[token]
+	if !ok {
+		return "", false, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(s.entries, token)
+		return "", false, nil
+	}
+	return e.payload, true, nil
+}
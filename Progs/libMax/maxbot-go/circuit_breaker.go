@@ -0,0 +1,271 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the API while the circuit
+// breaker for an endpoint is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of one endpoint's circuit breaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerConfig enables the client circuit breaker. Zero values pick
+// the defaults noted on each field.
+type CircuitBreakerConfig struct {
+	// Window is the period over which failures are counted (default 30s).
+	Window time.Duration
+	// MinRequests is the number of requests in a window before the breaker
+	// may open (default 10).
+	MinRequests int
+	// FailureRatio opens the breaker when reached (default 0.5).
+	FailureRatio float64
+	// OpenTimeout is how long the breaker stays open before letting probe
+	// requests through (default 15s).
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of concurrent probes (default 1).
+	HalfOpenRequests int
+	// Global uses one breaker for all endpoints instead of one per endpoint.
+	Global bool
+}
+
+type circuitBreakers struct {
+	cfg    CircuitBreakerConfig
+	logger Logger
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+type circuitBreaker struct {
+	state CircuitState
+	// generation changes on every transition; see circuitTicket.
+	generation uint64
+
+	windowEnd time.Time
+	requests  int
+	failures  int
+	openUntil time.Time
+	probes    int
+}
+
+func newCircuitBreakers(cfg CircuitBreakerConfig, logger Logger) *circuitBreakers {
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * time.Second
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.FailureRatio <= 0 {
+		cfg.FailureRatio = 0.5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 15 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	if logger == nil {
+		logger = NopLogger{}
+	}
+	return &circuitBreakers{cfg: cfg, logger: logger, breakers: make(map[string]*circuitBreaker)}
+}
+
+// circuitTicket is handed out by allow and passed back to record. Outcomes
+// of requests admitted before the breaker last changed state are ignored,
+// so a slow request from the closed state cannot close a half-open breaker.
+type circuitTicket struct {
+	endpoint   string
+	generation uint64
+}
+
+type routeKey struct{}
+
+// withRoute names the route template of a request, e.g. /chats/{chat_id},
+// so that requests to different IDs share one circuit breaker.
+func withRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// rawRoute folds every segment after the resource of a raw Client.Do path:
+// /messages/mid.1 becomes /messages/*.
+func rawRoute(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	resource, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if rest == "" {
+		return "/" + resource
+	}
+	return "/" + resource + "/*"
+}
+
+// endpoint names the breaker for a request: the method and the route
+// template attached to ctx, or the path without its query.
+func (cb *circuitBreakers) endpoint(ctx context.Context, method, path string) string {
+	if cb.cfg.Global {
+		return "*"
+	}
+	if route, ok := ctx.Value(routeKey{}).(string); ok {
+		return method + " " + route
+	}
+	path, _, _ = strings.Cut(path, "?")
+	return method + " " + path
+}
+
+// allow reports whether a request to endpoint may proceed and returns the
+// ticket to record its outcome with.
+func (cb *circuitBreakers) allow(endpoint string) (circuitTicket, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	b := cb.get(endpoint)
+	now := time.Now()
+	switch b.state {
+	case CircuitOpen:
+		if now.Before(b.openUntil) {
+			return circuitTicket{}, false
+		}
+		cb.transition(endpoint, b, CircuitHalfOpen)
+		b.probes = 1
+	case CircuitHalfOpen:
+		if b.probes >= cb.cfg.HalfOpenRequests {
+			return circuitTicket{}, false
+		}
+		b.probes++
+	default:
+		if now.After(b.windowEnd) {
+			b.windowEnd = now.Add(cb.cfg.Window)
+			b.requests, b.failures = 0, 0
+		}
+	}
+	return circuitTicket{endpoint: endpoint, generation: b.generation}, true
+}
+
+// record reports the outcome of an allowed request. Cancelled requests
+// only release their probe slot.
+func (cb *circuitBreakers) record(t circuitTicket, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	b := cb.get(t.endpoint)
+	if b.generation != t.generation {
+		return
+	}
+	failed := isCircuitFailure(err)
+	switch b.state {
+	case CircuitHalfOpen:
+		b.probes--
+		if isContextError(err) {
+			return
+		}
+		if failed {
+			b.openUntil = time.Now().Add(cb.cfg.OpenTimeout)
+			cb.transition(t.endpoint, b, CircuitOpen)
+			return
+		}
+		b.windowEnd = time.Now().Add(cb.cfg.Window)
+		b.requests, b.failures = 0, 0
+		cb.transition(t.endpoint, b, CircuitClosed)
+	case CircuitClosed:
+		if isContextError(err) {
+			return
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= cb.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= cb.cfg.FailureRatio {
+			b.openUntil = time.Now().Add(cb.cfg.OpenTimeout)
+			cb.transition(t.endpoint, b, CircuitOpen)
+		}
+	}
+}
+
+func (cb *circuitBreakers) get(endpoint string) *circuitBreaker {
+	b, ok := cb.breakers[endpoint]
+	if !ok {
+		b = &circuitBreaker{}
+		cb.breakers[endpoint] = b
+	}
+	return b
+}
+
+func (cb *circuitBreakers) transition(endpoint string, b *circuitBreaker, to CircuitState) {
+	if b.state == to {
+		return
+	}
+	if to == CircuitOpen {
+		cb.logger.Errorf("circuit breaker %s: %s -> %s (failures=%d/%d)", endpoint, b.state, to, b.failures, b.requests)
+	} else {
+		cb.logger.Infof("circuit breaker %s: %s -> %s", endpoint, b.state, to)
+	}
+	b.state = to
+	b.generation++
+	b.probes = 0
+}
+
+func (cb *circuitBreakers) states() map[string]CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	out := make(map[string]CircuitState, len(cb.breakers))
+	for endpoint, b := range cb.breakers {
+		state := b.state
+		if state == CircuitOpen && !time.Now().Before(b.openUntil) {
+			state = CircuitHalfOpen
+		}
+		out[endpoint] = state
+	}
+	return out
+}
+
+// isCircuitFailure reports whether err signals an unhealthy API: transport
+// errors, 5xx and 408. Client errors and 429 do not count.
+func isCircuitFailure(err error) bool {
+	if err == nil || isContextError(err) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// CircuitStates reports the circuit breaker state per endpoint, for health
+// checks. It is empty when the breaker is disabled.
+func (c *Client) CircuitStates() map[string]CircuitState {
+	if c.breakers == nil {
+		return map[string]CircuitState{}
+	}
+	return c.breakers.states()
+}
+
+// Healthy reports whether no circuit breaker is open.
+func (c *Client) Healthy() bool {
+	for _, state := range c.CircuitStates() {
+		if state == CircuitOpen {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package maxbot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensFailsFastAndRecovers(t *testing.T) {
+	var healthy atomic.Bool
+	var updateCalls, sendCalls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/messages" {
+			sendCalls.Add(1)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		updateCalls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"updates":[]}`))
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	c, err := NewClient(ClientConfig{
+		Token:        "test-token",
+		BaseURL:      ts.URL,
+		RateLimitRPS: -1,
+		Logger:       NewStdLogger(log.New(&logs, "", 0)),
+		CircuitBreaker: &CircuitBreakerConfig{
+			MinRequests: 3,
+			OpenTimeout: 50 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetUpdates(ctx, GetUpdatesOptions{Offset: int64(i + 1)}); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("breaker opened too early at request %d", i)
+		}
+	}
+	if _, err := c.GetUpdates(ctx, GetUpdatesOptions{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if got := updateCalls.Load(); got != 3 {
+		t.Fatalf("expected open breaker to skip the request, got %d calls", got)
+	}
+	if got := c.CircuitStates()["GET /updates"]; got != CircuitOpen || c.Healthy() {
+		t.Fatalf("expected open state, got %v (healthy=%v)", got, c.Healthy())
+	}
+	if err := c.SendMessage(ctx, SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("other endpoints should not be affected: %v", err)
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.GetUpdates(ctx, GetUpdatesOptions{}); err != nil {
+		t.Fatalf("expected probe to succeed, got %v", err)
+	}
+	if got := c.CircuitStates()["GET /updates"]; got != CircuitClosed || !c.Healthy() {
+		t.Fatalf("expected closed state after probe, got %v", got)
+	}
+
+	out := logs.String()
+	for _, want := range []string{"GET /updates: closed -> open", "open -> half-open", "half-open -> closed"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing transition %q in logs: %s", want, out)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenFailureReopens(t *testing.T) {
+	cb := newCircuitBreakers(CircuitBreakerConfig{MinRequests: 1, OpenTimeout: 10 * time.Millisecond}, nil)
+	ep := cb.endpoint(context.Background(), http.MethodGet, "/chats/123?x=1")
+	if ep != "GET /chats/123" {
+		t.Fatalf("unexpected endpoint %q", ep)
+	}
+	boom := errors.New("connection reset")
+
+	ticket, _ := cb.allow(ep)
+	cb.record(ticket, boom)
+	if _, ok := cb.allow(ep); ok {
+		t.Fatal("expected breaker to be open")
+	}
+	time.Sleep(15 * time.Millisecond)
+	probe, ok := cb.allow(ep)
+	if !ok {
+		t.Fatal("expected a probe after the open timeout")
+	}
+	if _, ok := cb.allow(ep); ok {
+		t.Fatal("expected only one concurrent probe")
+	}
+	cb.record(probe, &APIError{StatusCode: http.StatusBadGateway})
+	if _, ok := cb.allow(ep); ok {
+		t.Fatal("expected failed probe to reopen the breaker")
+	}
+}
+
+func TestCircuitBreakerIgnoresStaleOutcomes(t *testing.T) {
+	cb := newCircuitBreakers(CircuitBreakerConfig{MinRequests: 2, OpenTimeout: 10 * time.Millisecond}, nil)
+	ep := "GET /updates"
+	boom := errors.New("connection reset")
+
+	slow, _ := cb.allow(ep) // stays in flight while the breaker opens
+	for i := 0; i < 2; i++ {
+		ticket, _ := cb.allow(ep)
+		cb.record(ticket, boom)
+	}
+	time.Sleep(15 * time.Millisecond)
+	probe, ok := cb.allow(ep)
+	if !ok {
+		t.Fatal("expected a probe after the open timeout")
+	}
+
+	cb.record(slow, nil)
+	if got := cb.states()[ep]; got != CircuitHalfOpen {
+		t.Fatalf("a request admitted while closed must not close the breaker, got %v", got)
+	}
+	if _, ok := cb.allow(ep); ok {
+		t.Fatal("expected the probe slot to stay taken")
+	}
+
+	cb.record(probe, boom)
+	cb.record(probe, boom) // a duplicate record must not free extra probe slots
+	time.Sleep(15 * time.Millisecond)
+	if _, ok := cb.allow(ep); !ok {
+		t.Fatal("expected a new probe")
+	}
+	if _, ok := cb.allow(ep); ok {
+		t.Fatal("expected only one concurrent probe")
+	}
+}
+
+func TestCircuitBreakerKeysOnRouteTemplate(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, ClientConfig{CircuitBreaker: &CircuitBreakerConfig{MinRequests: 2}})
+	ctx := context.Background()
+	for _, id := range []ID{"mid.1", "mid.2", "mid.3"} {
+		_, _ = c.GetMessage(ctx, id)
+	}
+	for _, path := range []string{"/videos/a", "/videos/b", "/videos/c"} {
+		_, _ = c.Do(ctx, http.MethodGet, path, nil)
+	}
+
+	states := c.CircuitStates()
+	if len(states) != 2 || states["GET /messages/{message_id}"] != CircuitOpen || states["GET /videos/*"] != CircuitOpen {
+		t.Fatalf("expected one open breaker per route, got %v", states)
+	}
+	if got := calls.Load(); got != 4 {
+		t.Fatalf("expected the third call of each route to fail fast, got %d requests", got)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	cb := newCircuitBreakers(CircuitBreakerConfig{MinRequests: 1}, nil)
+	ep := cb.endpoint(context.Background(), http.MethodPost, "/messages")
+	for _, err := range []error{
+		&APIError{StatusCode: http.StatusBadRequest},
+		&APIError{StatusCode: http.StatusTooManyRequests},
+		context.Canceled,
+	} {
+		ticket, _ := cb.allow(ep)
+		cb.record(ticket, err)
+	}
+	if _, ok := cb.allow(ep); !ok {
+		t.Fatal("client errors must not open the breaker")
+	}
+}
+
+func TestOpenCircuitDoesNotWaitForRateLimiter(t *testing.T) {
+	limiter := &recordingLimiter{}
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, ClientConfig{RateLimiter: limiter, CircuitBreaker: &CircuitBreakerConfig{MinRequests: 1}})
+	ctx := context.Background()
+	_, _ = c.GetUpdates(ctx, GetUpdatesOptions{})
+	if _, err := c.GetUpdates(ctx, GetUpdatesOptions{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if n := len(limiter.keys); n != 1 {
+		t.Fatalf("expected an open circuit to skip the rate limiter, got %d waits", n)
+	}
+}
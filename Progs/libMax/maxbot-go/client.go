@@ -6,15 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"math"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -28,17 +25,49 @@ type ClientConfig struct {
 	MaxRetries     int
 	InitialBackoff time.Duration
 	MaxBackoff     time.Duration
+	// RetryPolicy replaces the DefaultRetryPolicy built from MaxRetries,
+	// InitialBackoff and MaxBackoff.
+	RetryPolicy RetryPolicy
+	// RateLimitRPS is the global request rate (default 30, negative
+	// disables all client-side limiting). RateLimitBurst defaults to 30.
 	RateLimitRPS   int
+	RateLimitBurst int
+	// ChatRateLimitRPS and ChatRateLimitBurst limit message sends per chat.
+	// The limit is off unless ChatRateLimitRPS is positive; the burst then
+	// defaults to 5. The rate may be fractional (20.0/60 for 20 a minute).
+	ChatRateLimitRPS   float64
+	ChatRateLimitBurst int
+	// RateLimiter replaces the built-in token buckets, e.g. with a limiter
+	// shared between processes.
+	RateLimiter RateLimiter
+	// DisableAdaptiveThrottling turns off the client-wide cooldown after
+	// 429 responses and the rate reduction after repeated ones. The throttle
+	// is also off when RateLimitRPS is negative; otherwise it lowers the
+	// rate reported by the limiter's RPS method (30 if it has none).
+	DisableAdaptiveThrottling bool
+	// IdempotencyWindow is how long a successful send with a caller-supplied
+	// idempotency key is remembered; repeating it is a no-op (default 10m,
+	// negative disables).
+	IdempotencyWindow time.Duration
+	// CircuitBreaker enables failing fast with ErrCircuitOpen while an
+	// endpoint keeps failing.
+	CircuitBreaker *CircuitBreakerConfig
+	// Logger receives client events such as circuit breaker transitions.
+	Logger Logger
+	// Middleware wraps every attempt, outermost first.
+	Middleware []ClientMiddleware
 }
 
 type Client struct {
-	token          string
-	baseURL        string
-	httpClient     *http.Client
-	maxRetries     int
-	initialBackoff time.Duration
-	maxBackoff     time.Duration
-	limiter        *rateLimiter
+	token       string
+	baseURL     string
+	httpClient  *http.Client
+	retry       RetryPolicy
+	limiter     RateLimiter
+	throttle    *adaptiveThrottle
+	sends       *sendCache
+	breakers    *circuitBreakers
+	middlewares []ClientMiddleware
 }
 
 func NewClient(cfg ClientConfig) (*Client, error) {
@@ -60,24 +89,53 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 	if maxBackoff <= 0 {
 		maxBackoff = 3 * time.Second
 	}
-	rps := cfg.RateLimitRPS
-	if rps == 0 {
-		rps = defaultRateLimitRPS
+	retry := cfg.RetryPolicy
+	if retry == nil {
+		retry = DefaultRetryPolicy{
+			MaxRetries:     cfg.MaxRetries,
+			InitialBackoff: initialBackoff,
+			MaxBackoff:     maxBackoff,
+		}
+	}
+	limiter := cfg.RateLimiter
+	if limiter == nil && cfg.RateLimitRPS >= 0 {
+		limiter = NewRateLimiter(RateLimitConfig{
+			RPS:       float64(cfg.RateLimitRPS),
+			Burst:     cfg.RateLimitBurst,
+			ChatRPS:   cfg.ChatRateLimitRPS,
+			ChatBurst: cfg.ChatRateLimitBurst,
+		})
+	}
+
+	var throttle *adaptiveThrottle
+	if !cfg.DisableAdaptiveThrottling && cfg.RateLimitRPS >= 0 {
+		throttle = newAdaptiveThrottle(limiterRPS(limiter))
 	}
 
-	var limiter *rateLimiter
-	if rps > 0 {
-		limiter = newRateLimiter(rps)
+	var sends *sendCache
+	if cfg.IdempotencyWindow >= 0 {
+		window := cfg.IdempotencyWindow
+		if window == 0 {
+			window = defaultIdempotencyWindow
+		}
+		sends = newSendCache(window)
+	}
+
+	var breakers *circuitBreakers
+	if cfg.CircuitBreaker != nil {
+		breakers = newCircuitBreakers(*cfg.CircuitBreaker, cfg.Logger)
 	}
 
 	return &Client{
-		token:          strings.TrimSpace(cfg.Token),
-		baseURL:        strings.TrimRight(cfg.BaseURL, "/"),
-		httpClient:     hc,
-		maxRetries:     cfg.MaxRetries,
-		initialBackoff: initialBackoff,
-		maxBackoff:     maxBackoff,
-		limiter:        limiter,
+		token:       strings.TrimSpace(cfg.Token),
+		baseURL:     strings.TrimRight(cfg.BaseURL, "/"),
+		httpClient:  hc,
+		retry:       retry,
+		limiter:     limiter,
+		throttle:    throttle,
+		sends:       sends,
+		breakers:    breakers,
+		middlewares: cfg.Middleware,
 	}, nil
 }
 
@@ -147,7 +205,49 @@ func (c *Client) GetUpdates(ctx context.Context, opts GetUpdatesOptions) ([]Upda
 }
 
 func (c *Client) SendMessage(ctx context.Context, req SendMessageRequest) error {
-	_, err := c.do(ctx, http.MethodPost, "/messages", req)
+	_, err := c.do(sendContext(ctx, req.ChatID, req.IdempotencyKey), http.MethodPost, "/messages", req)
+	return err
+}
+
+func (c *Client) EditMessageText(ctx context.Context, req EditMessageTextRequest) error {
+	_, err := c.do(ctx, http.MethodPatch, "/messages", req)
+	return err
+}
+
+func (c *Client) AnswerCallbackQuery(ctx context.Context, req AnswerCallbackQueryRequest) error {
+	_, err := c.do(ctx, http.MethodPost, "/callbacks/answer", req)
+	return err
+}
+
+func (c *Client) GetSubscriptions(ctx context.Context) ([]Subscription, error) {
+	body, err := c.do(ctx, http.MethodGet, "/subscriptions", nil)
+	if err != nil {
+		return nil, err
+	}
+	var wrapped struct {
+		Subscriptions []Subscription `json:"subscriptions"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("decode subscriptions response: %w", err)
+	}
+	return wrapped.Subscriptions, nil
+}
+
+func (c *Client) Subscribe(ctx context.Context, req SubscribeRequest) error {
+	if strings.TrimSpace(req.URL) == "" {
+		return fmt.Errorf("subscribe: url is required")
+	}
+	_, err := c.do(ctx, http.MethodPost, "/subscriptions", req)
+	return err
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, webhookURL string) error {
+	if strings.TrimSpace(webhookURL) == "" {
+		return fmt.Errorf("unsubscribe: url is required")
+	}
+	q := url.Values{}
+	q.Set("url", webhookURL)
+	_, err := c.do(ctx, http.MethodDelete, "/subscriptions?"+q.Encode(), nil)
 	return err
 }
 
@@ -202,7 +302,7 @@ func (c *Client) UploadMedia(ctx context.Context, req UploadMediaRequest) (*Uplo
 }
 
 func (c *Client) SendMedia(ctx context.Context, req SendMediaRequest) error {
-	_, err := c.do(ctx, http.MethodPost, "/messages/media", req)
+	_, err := c.do(sendContext(ctx, req.ChatID, req.IdempotencyKey), http.MethodPost, "/messages/media", req)
 	return err
 }
 
@@ -221,74 +321,125 @@ func (c *Client) do(ctx context.Context, method, path string, payload any) ([]by
 }
 
 func (c *Client) doRequest(ctx context.Context, method, path string, payloadBytes []byte, contentType string) ([]byte, error) {
-	var lastErr error
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
-		if c.limiter != nil {
-			if err := c.limiter.Wait(ctx); err != nil {
-				return nil, err
+	idem := idempotencyFrom(ctx)
+	// Only POST sends are remembered; reads and updates made under a keyed
+	// ctx must not be answered from the cache.
+	if idem.key != "" && !idem.auto && c.sends != nil && method == http.MethodPost {
+		return c.sends.do(ctx, sendCacheKey(method, path, payloadBytes, idem.key), func() ([]byte, error) {
+			return c.doAttempts(ctx, method, path, payloadBytes, contentType, idem)
+		})
+	}
+	return c.doAttempts(ctx, method, path, payloadBytes, contentType, idem)
+}
+
+// doAttempts runs the throttling, rate limiting and retry loop. The
+// idempotency key stays the same across attempts.
+func (c *Client) doAttempts(ctx context.Context, method, path string, payloadBytes []byte, contentType string, idem idempotency) ([]byte, error) {
+	key := rateLimitKeyFrom(ctx)
+	var endpoint string
+	if c.breakers != nil {
+		endpoint = c.breakers.endpoint(ctx, method, path)
+	}
+	for attempt := 0; ; attempt++ {
+		// The breaker is checked first so an open circuit fails fast
+		// without spending rate limit tokens.
+		var ticket circuitTicket
+		if c.breakers != nil {
+			var ok bool
+			if ticket, ok = c.breakers.allow(endpoint); !ok {
+				return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, endpoint)
 			}
 		}
-
-		var bodyReader io.Reader
-		if len(payloadBytes) > 0 {
-			bodyReader = bytes.NewReader(payloadBytes)
+		body, err := c.waitAndAttempt(ctx, key, method, path, payloadBytes, contentType, idem.key, attempt)
+		if c.breakers != nil {
+			c.breakers.record(ticket, err)
 		}
-
-		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
-		if err != nil {
-			return nil, fmt.Errorf("build request: %w", err)
+		if err == nil {
+			return body, nil
 		}
-		req.Header.Set("Authorization", c.token)
-		req.Header.Set("Accept", "application/json")
-		if strings.TrimSpace(contentType) != "" {
-			req.Header.Set("Content-Type", contentType)
+		if isContextError(err) {
+			return nil, err
 		}
 
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			if isContextError(err) {
-				return nil, err
-			}
-			lastErr = fmt.Errorf("request failed: %w", err)
-			if attempt == c.maxRetries {
-				return nil, lastErr
-			}
-			if err := sleepWithContext(ctx, c.retryBackoff(attempt)); err != nil {
-				return nil, err
-			}
-			continue
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && errors.Is(apiErr, ErrRateLimited) && c.throttle != nil {
+			c.throttle.observe429(key, apiErr.RetryAfter)
 		}
 
-		body, readErr := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if readErr != nil {
-			return nil, fmt.Errorf("read response: %w", readErr)
+		retry := c.retry
+		if retry == nil {
+			retry = DefaultRetryPolicy{}
 		}
-
-		if resp.StatusCode < http.StatusBadRequest {
-			return body, nil
+		rr := RetryRequest{Method: method, Path: path, Attempt: attempt}
+		if !idem.auto {
+			rr.IdempotencyKey = idem.key
 		}
-
-		apiErr := parseAPIError(resp.StatusCode, resp.Header.Get("Retry-After"), body)
-		lastErr = apiErr
-
-		if !shouldRetryStatus(resp.StatusCode) || attempt == c.maxRetries {
-			return nil, apiErr
+		delay, ok := retry.Retry(rr, err)
+		if !ok {
+			return nil, err
 		}
+		if err := sleepWithContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
 
-		delay := c.retryBackoff(attempt)
-		if apiErr.RetryAfter > 0 {
-			delay = apiErr.RetryAfter
+// waitAndAttempt passes the throttle and rate limiter, then performs one
+// attempt.
+func (c *Client) waitAndAttempt(ctx context.Context, key, method, path string, payloadBytes []byte, contentType, idemKey string, attempt int) ([]byte, error) {
+	var paced *tokenBucket
+	if c.throttle != nil {
+		var err error
+		if paced, err = c.throttle.wait(ctx, key); err != nil {
+			return nil, err
 		}
-		if err := sleepWithContext(ctx, delay); err != nil {
+	}
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx, key); err != nil {
+			// The request is not sent, so give the throttle token back.
+			if paced != nil {
+				paced.refund()
+			}
 			return nil, err
 		}
 	}
+	return c.attempt(ctx, method, path, payloadBytes, contentType, idemKey, attempt)
+}
+
+// attempt performs one round trip through the client middlewares and
+// returns the body of a successful response, an *APIError, or a transport
+// error.
+func (c *Client) attempt(ctx context.Context, method, path string, payloadBytes []byte, contentType, idemKey string, attempt int) ([]byte, error) {
+	req := &ClientRequest{
+		Method:  method,
+		Path:    path,
+		Header:  make(http.Header),
+		Payload: payloadBytes,
+		Attempt: attempt,
+	}
+	req.Header.Set("Authorization", c.token)
+	req.Header.Set("Accept", "application/json")
+	if strings.TrimSpace(contentType) != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if idemKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idemKey)
+	}
 
-	if lastErr != nil {
-		return nil, lastErr
+	resp, err := chainClient(c.middlewares, c.roundTrip)(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("client middleware returned no response")
 	}
-	return nil, errors.New("request failed")
+	if resp.StatusCode < http.StatusBadRequest && resp.Err == nil {
+		return resp.Body, nil
+	}
+	if resp.Err == nil {
+		resp.Err = parseAPIError(resp.StatusCode, resp.Header.Get("Retry-After"), resp.Body)
+	}
+	return nil, resp.Err
 }
 
 func parseAPIError(statusCode int, retryAfter string, body []byte) *APIError {
@@ -319,31 +470,26 @@ func parseAPIError(statusCode int, retryAfter string, body []byte) *APIError {
 	return errObj
 }
 
-func (c *Client) retryBackoff(attempt int) time.Duration {
-	delay := float64(c.initialBackoff) * math.Pow(2, float64(attempt))
-	if delay > float64(c.maxBackoff) {
-		return c.maxBackoff
-	}
-	return time.Duration(delay)
-}
-
-func shouldRetryStatus(statusCode int) bool {
-	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout {
-		return true
-	}
-	return statusCode >= http.StatusInternalServerError
-}
-
+// parseRetryAfter accepts both delay-seconds and HTTP-date values.
 func parseRetryAfter(v string) time.Duration {
 	v = strings.TrimSpace(v)
 	if v == "" {
 		return 0
 	}
-	seconds, err := strconv.Atoi(v)
-	if err != nil || seconds <= 0 {
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
 		return 0
 	}
-	return time.Duration(seconds) * time.Second
+	if d := time.Until(at); d > 0 {
+		return d
+	}
+	return 0
 }
 
 func sleepWithContext(ctx context.Context, d time.Duration) error {
@@ -363,42 +509,3 @@ func sleepWithContext(ctx context.Context, d time.Duration) error {
 func isContextError(err error) bool {
 	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
 }
-
-type rateLimiter struct {
-	mu       sync.Mutex
-	interval time.Duration
-	last     time.Time
-}
-
-func newRateLimiter(rps int) *rateLimiter {
-	if rps <= 0 {
-		return nil
-	}
-	interval := time.Second / time.Duration(rps)
-	if interval <= 0 {
-		interval = time.Nanosecond
-	}
-	return &rateLimiter{interval: interval}
-}
-
-func (r *rateLimiter) Wait(ctx context.Context) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	now := time.Now()
-	if r.last.IsZero() {
-		r.last = now
-		return nil
-	}
-	next := r.last.Add(r.interval)
-	if !next.After(now) {
-		r.last = now
-		return nil
-	}
-	wait := next.Sub(now)
-	if err := sleepWithContext(ctx, wait); err != nil {
-		return err
-	}
-	r.last = time.Now()
-	return nil
-}
@@ -0,0 +1,84 @@
+package maxbot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ClientRequest is one attempt of an API call as seen by ClientMiddleware.
+// Middlewares may modify it before calling next.
+type ClientRequest struct {
+	Method string
+	// Path is relative to the base URL and includes the query string.
+	Path    string
+	Header  http.Header
+	Payload []byte
+	// Attempt is zero-based; retries of the same call share everything
+	// else, including the idempotency key header.
+	Attempt int
+}
+
+// ClientResponse is the outcome of an attempt that reached the API (or a
+// middleware standing in for it).
+type ClientResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Err is the parsed error for status codes >= 400. A middleware
+	// returning a response without Err gets it filled in.
+	Err *APIError
+}
+
+// ClientHandler performs an attempt. A non-nil error means no response was
+// received (transport failure); API errors are reported in the response.
+type ClientHandler func(ctx context.Context, req *ClientRequest) (*ClientResponse, error)
+
+// ClientMiddleware wraps each attempt, e.g. for logging, metrics, tracing
+// headers, request mutation or mocking the API.
+type ClientMiddleware func(next ClientHandler) ClientHandler
+
+func chainClient(middlewares []ClientMiddleware, final ClientHandler) ClientHandler {
+	h := final
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// roundTrip is the innermost ClientHandler: it sends req over HTTP.
+func (c *Client) roundTrip(ctx context.Context, req *ClientRequest) (*ClientResponse, error) {
+	var bodyReader io.Reader
+	if len(req.Payload) > 0 {
+		bodyReader = bytes.NewReader(req.Payload)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, c.baseURL+req.Path, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	httpReq.Header = req.Header.Clone()
+	if httpReq.Header == nil {
+		httpReq.Header = make(http.Header)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if isContextError(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	body, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if readErr != nil {
+		return nil, fmt.Errorf("read response: %w", readErr)
+	}
+
+	out := &ClientResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+	if resp.StatusCode >= http.StatusBadRequest {
+		out.Err = parseAPIError(resp.StatusCode, resp.Header.Get("Retry-After"), body)
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientMiddlewareWrapsEachAttempt(t *testing.T) {
+	var calls atomic.Int32
+	var gotTrace string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTrace = r.Header.Get("X-Trace-Id")
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"code":"bad_gateway"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"updates":[]}`))
+	}))
+	defer ts.Close()
+
+	var log []string
+	record := func(name string) ClientMiddleware {
+		return func(next ClientHandler) ClientHandler {
+			return func(ctx context.Context, req *ClientRequest) (*ClientResponse, error) {
+				log = append(log, fmt.Sprintf("%s>%s %s #%d", name, req.Method, req.Path, req.Attempt))
+				resp, err := next(ctx, req)
+				if err == nil {
+					entry := fmt.Sprintf("%s<%d", name, resp.StatusCode)
+					if resp.Err != nil {
+						entry += " " + resp.Err.Code
+					}
+					log = append(log, entry)
+				}
+				return resp, err
+			}
+		}
+	}
+	tracing := func(next ClientHandler) ClientHandler {
+		return func(ctx context.Context, req *ClientRequest) (*ClientResponse, error) {
+			req.Header.Set("X-Trace-Id", "abc")
+			return next(ctx, req)
+		}
+	}
+
+	c, err := NewClient(ClientConfig{
+		Token:          "test-token",
+		BaseURL:        ts.URL,
+		MaxRetries:     1,
+		InitialBackoff: time.Millisecond,
+		RateLimitRPS:   -1,
+		Middleware:     []ClientMiddleware{record("outer"), tracing, record("inner")},
+	})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	if _, err := c.GetUpdates(context.Background(), GetUpdatesOptions{Limit: 5}); err != nil {
+		t.Fatalf("GetUpdates error: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"outer>GET /updates?limit=5 #0", "inner>GET /updates?limit=5 #0", "inner<502 bad_gateway", "outer<502 bad_gateway",
+		"outer>GET /updates?limit=5 #1", "inner>GET /updates?limit=5 #1", "inner<200", "outer<200",
+	}, "\n")
+	if got := strings.Join(log, "\n"); got != want {
+		t.Fatalf("unexpected middleware log:\n%s\nwant:\n%s", got, want)
+	}
+	if gotTrace != "abc" {
+		t.Fatalf("expected mutated header to reach the server, got %q", gotTrace)
+	}
+}
+
+func TestClientMiddlewareCanMockAPI(t *testing.T) {
+	mock := func(next ClientHandler) ClientHandler {
+		return func(ctx context.Context, req *ClientRequest) (*ClientResponse, error) {
+			switch {
+			case req.Path == "/messages" && strings.Contains(string(req.Payload), `"text":"forbidden"`):
+				return &ClientResponse{StatusCode: http.StatusForbidden, Body: []byte(`{"code":"chat.denied","message":"no access"}`)}, nil
+			case req.Path == "/messages":
+				return &ClientResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}, nil
+			default:
+				return nil, errors.New("unexpected request")
+			}
+		}
+	}
+	c, err := NewClient(ClientConfig{
+		Token:        "test-token",
+		BaseURL:      "http://127.0.0.1:1",
+		RateLimitRPS: -1,
+		Middleware:   []ClientMiddleware{mock},
+	})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	ctx := context.Background()
+	if err := c.SendMessage(ctx, SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+	err = c.SendMessage(ctx, SendMessageRequest{ChatID: "1", Text: "forbidden"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "chat.denied" {
+		t.Fatalf("expected parsed APIError from mocked response, got %v", err)
+	}
+}
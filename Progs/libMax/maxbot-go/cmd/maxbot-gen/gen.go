@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	typesFile     = "types_gen.go"
+	endpointsFile = "endpoints_gen.go"
+
+	// actionResult responses are checked by Client.doAction instead of
+	// being decoded.
+	actionResult = "SimpleQueryResult"
+)
+
+// generate renders the Go files for the spec in data. source names the
+// spec in the generated header.
+func generate(data []byte, source string) (map[string][]byte, error) {
+	s, ops, err := parseSpec(data)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{spec: s, ops: ops, source: source}
+	types, err := g.types()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", typesFile, err)
+	}
+	endpoints, err := g.endpoints()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", endpointsFile, err)
+	}
+	return map[string][]byte{typesFile: types, endpointsFile: endpoints}, nil
+}
+
+type generator struct {
+	spec   *spec
+	ops    []*operation
+	source string
+}
+
+func (g *generator) header(buf *bytes.Buffer, imports []string) {
+	fmt.Fprintf(buf, "// Code generated by maxbot-gen from %s. DO NOT EDIT.\n\npackage maxbot\n\n", g.source)
+	if len(imports) > 0 {
+		buf.WriteString("import (\n")
+		for _, imp := range imports {
+			fmt.Fprintf(buf, "\t%q\n", imp)
+		}
+		buf.WriteString(")\n\n")
+	}
+}
+
+func (g *generator) types() ([]byte, error) {
+	requestParams := map[string]*operation{}
+	for _, op := range g.ops {
+		if op.GoRequest != "" && !op.GoHandwritten {
+			requestParams[op.GoRequest] = op
+		}
+	}
+
+	var body bytes.Buffer
+	for _, name := range g.spec.Components.Schemas.Keys {
+		sc := g.spec.Components.Schemas.Values[name]
+		if sc.GoExternal {
+			continue
+		}
+		if len(sc.Enum) > 0 {
+			if err := g.enum(&body, name, sc); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var params []parameter
+		if op := requestParams[name]; op != nil {
+			params = op.Parameters
+			delete(requestParams, name)
+		}
+		if err := g.object(&body, name, sc, params); err != nil {
+			return nil, err
+		}
+	}
+	// Parameter-only request structs, in operation order.
+	for _, op := range g.ops {
+		if _, ok := requestParams[op.GoRequest]; !ok {
+			continue
+		}
+		if op.bodySchema() != nil {
+			return nil, fmt.Errorf("%s: request body must be the %s schema", op.OperationID, op.GoRequest)
+		}
+		if err := g.object(&body, op.GoRequest, &schema{}, op.Parameters); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	g.header(&buf, nil)
+	buf.Write(body.Bytes())
+	return formatSource(buf.Bytes())
+}
+
+func (g *generator) enum(buf *bytes.Buffer, name string, sc *schema) error {
+	if len(sc.GoEnumNames) != len(sc.Enum) {
+		return fmt.Errorf("%s: x-go-enum-names must name every enum value", name)
+	}
+	writeComment(buf, "", sc.Description)
+	fmt.Fprintf(buf, "type %s string\n\nconst (\n", name)
+	for i, v := range sc.Enum {
+		fmt.Fprintf(buf, "\t%s %s = %q\n", sc.GoEnumNames[i], name, v)
+	}
+	buf.WriteString(")\n\n")
+	return nil
+}
+
+// object writes a struct for sc. params become leading fields, excluded
+// from JSON when the struct is also a request body.
+func (g *generator) object(buf *bytes.Buffer, name string, sc *schema, params []parameter) error {
+	parts := []*schema{sc}
+	if len(sc.AllOf) > 0 {
+		parts = sc.AllOf
+	}
+	isBody := len(sc.Properties.Keys) > 0 || len(sc.AllOf) > 0
+
+	writeComment(buf, "", sc.Description)
+	fmt.Fprintf(buf, "type %s struct {\n", name)
+	for _, p := range params {
+		t, err := g.goType(p.Schema)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, p.Name, err)
+		}
+		writeComment(buf, "\t", p.Description)
+		if isBody {
+			fmt.Fprintf(buf, "\t%s %s `json:\"-\"`\n", goName(p.Name), t)
+		} else {
+			fmt.Fprintf(buf, "\t%s %s\n", goName(p.Name), t)
+		}
+	}
+	for _, part := range parts {
+		if part.Ref != "" {
+			embedded, _, err := g.spec.resolve(part)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			fmt.Fprintf(buf, "\t%s\n", embedded)
+			continue
+		}
+		for _, prop := range part.Properties.Keys {
+			ps := part.Properties.Values[prop]
+			t, err := g.goType(ps)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", name, prop, err)
+			}
+			tag := prop
+			if !slices.Contains(part.Required, prop) {
+				tag += ",omitempty"
+			}
+			writeComment(buf, "\t", ps.Description)
+			fmt.Fprintf(buf, "\t%s %s `json:\"%s\"`\n", goName(prop), t, tag)
+		}
+	}
+	buf.WriteString("}\n\n")
+	return nil
+}
+
+func (g *generator) goType(sc *schema) (string, error) {
+	if sc == nil {
+		return "", fmt.Errorf("missing schema")
+	}
+	var t string
+	switch {
+	case sc.Ref != "":
+		name, _, err := g.spec.resolve(sc)
+		if err != nil {
+			return "", err
+		}
+		t = name
+	case sc.GoType != "":
+		t = sc.GoType
+	case sc.Type == "string":
+		t = "string"
+	case sc.Type == "boolean":
+		t = "bool"
+	case sc.Type == "number":
+		t = "float64"
+	case sc.Type == "integer" && sc.Format == "int64":
+		t = "int64"
+	case sc.Type == "integer":
+		t = "int"
+	case sc.Type == "array":
+		item, err := g.goType(sc.Items)
+		if err != nil {
+			return "", err
+		}
+		t = "[]" + item
+	default:
+		return "", fmt.Errorf("unsupported schema type %q", sc.Type)
+	}
+	if sc.Nullable {
+		t = "*" + t
+	}
+	return t, nil
+}
+
+func (g *generator) endpoints() ([]byte, error) {
+	var body bytes.Buffer
+	for _, op := range g.ops {
+		if op.GoHandwritten {
+			continue
+		}
+		if err := g.method(&body, op); err != nil {
+			return nil, fmt.Errorf("%s: %w", op.OperationID, err)
+		}
+	}
+	var imports []string
+	for _, imp := range []string{"context", "encoding/json", "fmt", "net/http", "net/url", "strconv", "strings"} {
+		if bytes.Contains(body.Bytes(), []byte(imp[strings.LastIndex(imp, "/")+1:]+".")) {
+			imports = append(imports, imp)
+		}
+	}
+	var buf bytes.Buffer
+	g.header(&buf, imports)
+	buf.Write(body.Bytes())
+	return formatSource(buf.Bytes())
+}
+
+// field is a value the method reads: a parameter or a body property.
+type field struct {
+	name     string
+	expr     string
+	typ      string
+	schema   *schema
+	required bool
+}
+
+func (g *generator) method(buf *bytes.Buffer, op *operation) error {
+	label := words(op.OperationID)
+
+	var bodySchema *schema
+	if b := op.bodySchema(); b != nil {
+		name, resolved, err := g.spec.resolve(b)
+		if err != nil {
+			return err
+		}
+		if name == "" || name != op.GoRequest {
+			return fmt.Errorf("request body must be a $ref to the x-go-request schema")
+		}
+		bodySchema = resolved
+	}
+
+	args := "ctx context.Context"
+	argName := "req"
+	if strings.HasSuffix(op.GoRequest, "Options") {
+		argName = "opts"
+	}
+	if op.GoRequest != "" {
+		args += ", " + argName + " " + op.GoRequest
+	}
+	var params []field
+	for _, p := range op.Parameters {
+		t, err := g.goType(p.Schema)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		f := field{name: p.Name, typ: t, schema: p.Schema, required: p.Required || p.In == "path"}
+		if op.GoRequest != "" {
+			f.expr = argName + "." + goName(p.Name)
+		} else {
+			f.expr = lowerName(p.Name)
+			args += ", " + f.expr + " " + t
+		}
+		params = append(params, f)
+	}
+	byName := map[string]field{}
+	for _, f := range params {
+		byName[f.name] = f
+	}
+	var required []field
+	for _, f := range params {
+		if f.required {
+			required = append(required, f)
+		}
+	}
+	if bodySchema != nil {
+		for _, prop := range bodySchema.Required {
+			ps := bodySchema.Properties.Values[prop]
+			t, err := g.goType(ps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", prop, err)
+			}
+			required = append(required, field{name: prop, expr: argName + "." + goName(prop), typ: t, schema: ps})
+		}
+	}
+
+	// Result shape.
+	respName, respSchema, err := g.spec.resolve(op.responseSchema())
+	if err != nil {
+		return err
+	}
+	var result, zero, unwrapType string
+	switch {
+	case respName == actionResult:
+		result = "error"
+	case op.GoUnwrap != "":
+		if respSchema == nil {
+			return fmt.Errorf("x-go-unwrap needs a response schema")
+		}
+		ps, ok := respSchema.Properties.Values[op.GoUnwrap]
+		if !ok {
+			return fmt.Errorf("response has no %q property", op.GoUnwrap)
+		}
+		if unwrapType, err = g.goType(ps); err != nil {
+			return err
+		}
+		result, zero = "("+unwrapType+", error)", "nil"
+	case respName != "":
+		result, zero = "(*"+respName+", error)", "nil"
+	default:
+		return fmt.Errorf("unsupported response schema")
+	}
+	fail := func(e string) string {
+		if zero == "" {
+			return "return " + e
+		}
+		return "return " + zero + ", " + e
+	}
+
+	writeComment(buf, "", op.Description)
+	fmt.Fprintf(buf, "func (c *Client) %s(%s) %s {\n", op.OperationID, args, result)
+
+	for _, f := range required {
+		verb := "is"
+		if strings.HasPrefix(f.typ, "[]") {
+			verb = "are"
+		}
+		fmt.Fprintf(buf, "\tif %s {\n\t\t%s\n\t}\n", g.emptyCheck(f), fail(fmt.Sprintf("fmt.Errorf(%q)", label+": "+words(f.name)+" "+verb+" required")))
+	}
+	if len(op.GoRequireOneOf) > 0 {
+		var conds, names []string
+		for _, name := range op.GoRequireOneOf {
+			f, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("x-go-require-one-of: unknown parameter %s", name)
+			}
+			conds = append(conds, g.emptyCheck(f))
+			names = append(names, words(name))
+		}
+		msg := label + ": " + strings.Join(names, " or ") + " are required"
+		fmt.Fprintf(buf, "\tif %s {\n\t\t%s\n\t}\n", strings.Join(conds, " && "), fail(fmt.Sprintf("fmt.Errorf(%q)", msg)))
+	}
+
+	path, err := g.pathExpr(op.Path, byName)
+	if err != nil {
+		return err
+	}
+	hasQuery := false
+	for _, f := range params {
+		if p := findParam(op.Parameters, f.name); p.In != "query" {
+			continue
+		}
+		if !hasQuery {
+			buf.WriteString("\tq := url.Values{}\n")
+			hasQuery = true
+		}
+		set, err := g.querySet(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(set)
+	}
+	if hasQuery {
+		path = "withQuery(" + path + ", q)"
+	}
+	if strings.ContainsAny(path, "(+") {
+		fmt.Fprintf(buf, "\tpath := %s\n", path)
+		path = "path"
+	}
+	payload := "nil"
+	if bodySchema != nil {
+		payload = argName
+	}
+	method := "http.Method" + strings.ToUpper(op.Method[:1]) + strings.ToLower(op.Method[1:])
+
+	if strings.Contains(op.Path, "{") {
+		// The template keys the circuit breaker instead of the concrete IDs.
+		fmt.Fprintf(buf, "\tctx = withRoute(ctx, %q)\n", op.Path)
+	}
+	if respName == actionResult {
+		fmt.Fprintf(buf, "\treturn c.doAction(ctx, %s, %s, %s)\n}\n\n", method, path, payload)
+		return nil
+	}
+	fmt.Fprintf(buf, "\tbody, err := c.do(ctx, %s, %s, %s)\n\tif err != nil {\n\t\t%s\n\t}\n", method, path, payload, fail("err"))
+	if op.GoUnwrap != "" {
+		fmt.Fprintf(buf, "\tvar wrapped struct {\n\t\t%s %s `json:%q`\n\t}\n", goName(op.GoUnwrap), unwrapType, op.GoUnwrap)
+		fmt.Fprintf(buf, "\tif err := json.Unmarshal(body, &wrapped); err != nil {\n\t\t%s\n\t}\n", fail(fmt.Sprintf("fmt.Errorf(%q, err)", "decode "+words(op.GoUnwrap)+" response: %w")))
+		fmt.Fprintf(buf, "\treturn wrapped.%s, nil\n}\n\n", goName(op.GoUnwrap))
+		return nil
+	}
+	fmt.Fprintf(buf, "\tvar out %s\n", respName)
+	fmt.Fprintf(buf, "\tif err := json.Unmarshal(body, &out); err != nil {\n\t\t%s\n\t}\n", fail(fmt.Sprintf("fmt.Errorf(%q, err)", "decode "+words(respName)+" response: %w")))
+	buf.WriteString("\treturn &out, nil\n}\n\n")
+	return nil
+}
+
+// kind reduces a schema to the categories that need distinct code.
+func (g *generator) kind(sc *schema) string {
+	if sc.Nullable {
+		return "pointer"
+	}
+	if sc.Ref != "" {
+		_, target, err := g.spec.resolve(sc)
+		if err != nil || target == nil {
+			return "other"
+		}
+		if len(target.Enum) > 0 {
+			return "enum"
+		}
+		return g.kind(target)
+	}
+	switch {
+	case sc.Type == "array":
+		return "slice"
+	case sc.GoType == "ID":
+		return "id"
+	case sc.Type == "string":
+		return "string"
+	case sc.Type == "boolean":
+		return "bool"
+	case sc.Type == "integer" && sc.Format == "int64":
+		return "int64"
+	case sc.Type == "integer":
+		return "int"
+	}
+	return "other"
+}
+
+func (g *generator) emptyCheck(f field) string {
+	switch g.kind(f.schema) {
+	case "slice":
+		return "len(" + f.expr + ") == 0"
+	case "id":
+		return "strings.TrimSpace(string(" + f.expr + ")) == \"\""
+	case "string":
+		return "strings.TrimSpace(" + f.expr + ") == \"\""
+	case "enum":
+		return f.expr + " == \"\""
+	case "pointer":
+		return f.expr + " == nil"
+	case "bool":
+		return "!" + f.expr
+	default:
+		return f.expr + " == 0"
+	}
+}
+
+func (g *generator) querySet(f field) (string, error) {
+	var cond, value string
+	switch g.kind(f.schema) {
+	case "int":
+		cond, value = f.expr+" > 0", "strconv.Itoa("+f.expr+")"
+	case "int64":
+		cond, value = f.expr+" != 0", "strconv.FormatInt("+f.expr+", 10)"
+	case "bool":
+		cond, value = f.expr, `"true"`
+	case "id":
+		cond, value = f.expr+` != ""`, "string("+f.expr+")"
+	case "string":
+		cond, value = f.expr+` != ""`, f.expr
+	case "slice":
+		cond = "len(" + f.expr + ") > 0"
+		switch f.typ {
+		case "[]ID":
+			value = "joinIDs(" + f.expr + ")"
+		case "[]string":
+			value = "strings.Join(" + f.expr + `, ",")`
+		default:
+			return "", fmt.Errorf("%s: unsupported query type %s", f.name, f.typ)
+		}
+	default:
+		return "", fmt.Errorf("%s: unsupported query type %s", f.name, f.typ)
+	}
+	set := fmt.Sprintf("q.Set(%q, %s)", f.name, value)
+	if f.required {
+		return "\t" + set + "\n", nil
+	}
+	return fmt.Sprintf("\tif %s {\n\t\t%s\n\t}\n", cond, set), nil
+}
+
+// pathExpr turns /chats/{chat_id}/pin into a Go expression escaping each
+// path parameter.
+func (g *generator) pathExpr(path string, params map[string]field) (string, error) {
+	var parts []string
+	for path != "" {
+		open := strings.IndexByte(path, '{')
+		if open < 0 {
+			parts = append(parts, fmt.Sprintf("%q", path))
+			break
+		}
+		end := strings.IndexByte(path[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated parameter in path")
+		}
+		if open > 0 {
+			parts = append(parts, fmt.Sprintf("%q", path[:open]))
+		}
+		name := path[open+1 : open+end]
+		f, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("path parameter %s is not declared", name)
+		}
+		switch g.kind(f.schema) {
+		case "id":
+			parts = append(parts, "url.PathEscape(string("+f.expr+"))")
+		case "string":
+			parts = append(parts, "url.PathEscape("+f.expr+")")
+		case "int64":
+			parts = append(parts, "strconv.FormatInt("+f.expr+", 10)")
+		default:
+			return "", fmt.Errorf("path parameter %s: unsupported type %s", name, f.typ)
+		}
+		path = path[open+end+1:]
+	}
+	return strings.Join(parts, "+"), nil
+}
+
+func findParam(params []parameter, name string) parameter {
+	for _, p := range params {
+		if p.Name == name {
+			return p
+		}
+	}
+	return parameter{}
+}
+
+var initialisms = map[string]string{"id": "ID", "ids": "IDs", "url": "URL", "urls": "URLs", "api": "API"}
+
+// goName converts snake_case to an exported Go name.
+func goName(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if v, ok := initialisms[part]; ok {
+			b.WriteString(v)
+			continue
+		}
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// lowerName converts snake_case to an unexported Go name.
+func lowerName(s string) string {
+	first, rest, _ := strings.Cut(s, "_")
+	return first + goName(rest)
+}
+
+// words splits a snake_case or CamelCase name into lower-case words, for
+// error messages.
+func words(s string) string {
+	if strings.Contains(s, "_") {
+		return strings.ReplaceAll(s, "_", " ")
+	}
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func writeComment(buf *bytes.Buffer, indent, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(buf, "%s// %s\n", indent, strings.TrimSpace(line))
+	}
+}
+
+func formatSource(src []byte) ([]byte, error) {
+	out, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, src)
+	}
+	return out, nil
+}
@@ -0,0 +1,66 @@
+// Command maxbot-gen generates maxbot-go types and Client methods from the
+// checked-in OpenAPI schema and checks the hand-written endpoints and types
+// against it. Run it from the module root:
+//
+//	go run ./cmd/maxbot-gen            // rewrite types_gen.go and endpoints_gen.go
+//	go run ./cmd/maxbot-gen -check     // fail if the files are stale or drifted
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func main() {
+	specPath := flag.String("spec", "api/openapi.json", "OpenAPI schema to generate from")
+	outDir := flag.String("out", ".", "directory of the maxbot package")
+	check := flag.Bool("check", false, "report stale files instead of writing them")
+	flag.Parse()
+
+	if err := run(*specPath, *outDir, *check); err != nil {
+		fmt.Fprintln(os.Stderr, "maxbot-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, outDir string, check bool) error {
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return err
+	}
+	files, err := generate(data, filepath.ToSlash(specPath))
+	if err != nil {
+		return err
+	}
+	if err := verify(data, outDir); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var stale []string
+	for _, name := range names {
+		path := filepath.Join(outDir, name)
+		if check {
+			current, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(current, files[name]) {
+				stale = append(stale, name)
+			}
+			continue
+		}
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("stale generated files %v; run go generate", stale)
+	}
+	return nil
+}
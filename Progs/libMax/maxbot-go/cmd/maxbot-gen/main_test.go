@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedCodeIsUpToDate(t *testing.T) {
+	data, err := os.ReadFile("../../api/openapi.json")
+	if err != nil {
+		t.Fatalf("read spec: %v", err)
+	}
+	files, err := generate(data, "api/openapi.json")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join("../..", name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s is stale; run go generate in the module root", name)
+		}
+	}
+	if err := verify(data, "../.."); err != nil {
+		t.Fatalf("hand-written code drifted from the spec: %v", err)
+	}
+}
+
+func TestVerifyReportsDrift(t *testing.T) {
+	const spec = `{
+		"paths": {
+			"/messages": {"post": {"operationId": "SendMessage", "x-go-handwritten": true, "responses": {}}}
+		},
+		"components": {"schemas": {
+			"SendMessageRequest": {"type": "object", "x-go-external": true, "properties": {"chat_id": {"type": "string"}, "text": {"type": "string"}}}
+		}}
+	}`
+	cases := map[string]struct {
+		src  string
+		want string
+	}{
+		"in sync": {src: `
+type SendMessageRequest struct {
+	ChatID string ` + "`json:\"chat_id\"`" + `
+	Text   string ` + "`json:\"text\"`" + `
+	Key    string ` + "`json:\"-\"`" + `
+}
+func (c *Client) SendMessage() { c.do(http.MethodPost, "/messages") }
+`},
+		"missing method": {src: `
+type SendMessageRequest struct {
+	ChatID string ` + "`json:\"chat_id\"`" + `
+	Text   string ` + "`json:\"text\"`" + `
+}
+`, want: "no Client.SendMessage method"},
+		"wrong path": {src: `
+type SendMessageRequest struct {
+	ChatID string ` + "`json:\"chat_id\"`" + `
+	Text   string ` + "`json:\"text\"`" + `
+}
+func (c *Client) SendMessage() { c.do(http.MethodPost, "/messages/send") }
+`, want: "does not call POST /messages"},
+		"undescribed endpoint": {src: `
+type SendMessageRequest struct {
+	ChatID string ` + "`json:\"chat_id\"`" + `
+	Text   string ` + "`json:\"text\"`" + `
+}
+func (c *Client) SendMessage() { c.do(http.MethodPost, "/messages") }
+func (c *Client) DeleteMessage() { c.do(http.MethodDelete, "/messages") }
+`, want: "Client.DeleteMessage calls the API but is not in the spec"},
+		"field drift": {src: `
+type SendMessageRequest struct {
+	ChatID string ` + "`json:\"chat_id\"`" + `
+	Body   string ` + "`json:\"body\"`" + `
+}
+func (c *Client) SendMessage() { c.do(http.MethodPost, "/messages") }
+`, want: "missing [text], not in schema [body]"},
+	}
+	for name, tc := range cases {
+		dir := t.TempDir()
+		src := "package maxbot\n\nimport \"net/http\"\n\ntype Client struct{}\n\nfunc (c *Client) do(string, string) {}\n\nvar _ = http.MethodGet\n" + tc.src
+		if err := os.WriteFile(filepath.Join(dir, "client.go"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := verify([]byte(spec), dir)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Fatalf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestGenerateRejectsInvalidSpecs(t *testing.T) {
+	cases := map[string]string{
+		"missing operationId": `{"paths":{"/me":{"get":{"responses":{}}}}}`,
+		"unknown ref":         `{"paths":{"/me":{"get":{"operationId":"GetMe","responses":{"200":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/Nope"}}}}}}}}}`,
+		"undeclared path param": `{"paths":{"/chats/{chat_id}":{"delete":{"operationId":"LeaveChat","responses":{"200":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/SimpleQueryResult"}}}}}}}},
+			"components":{"schemas":{"SimpleQueryResult":{"type":"object","x-go-external":true}}}}`,
+	}
+	for name, spec := range cases {
+		if _, err := generate([]byte(spec), "spec.json"); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	for in, want := range map[string]string{"chat_id": "ChatID", "user_ids": "UserIDs", "full_avatar_url": "FullAvatarURL", "is_bot": "IsBot"} {
+		if got := goName(in); got != want {
+			t.Fatalf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := lowerName("message_id"); got != "messageID" {
+		t.Fatalf("lowerName = %q", got)
+	}
+	if got := words("GetChatMembers"); got != "get chat members" {
+		t.Fatalf("words = %q", got)
+	}
+	if got := words("user_ids"); got != "user ids" {
+		t.Fatalf("words = %q", got)
+	}
+}
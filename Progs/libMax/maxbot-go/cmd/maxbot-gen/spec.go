@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// spec is the subset of OpenAPI 3 understood by the generator.
+type spec struct {
+	Paths      ordered[map[string]json.RawMessage] `json:"paths"`
+	Components struct {
+		Schemas ordered[*schema] `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	Method      string `json:"-"`
+	Path        string `json:"-"`
+	OperationID string `json:"operationId"`
+	Description string `json:"description"`
+	Parameters  []parameter
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"responses"`
+
+	GoRequest      string   `json:"x-go-request"`
+	GoUnwrap       string   `json:"x-go-unwrap"`
+	GoRequireOneOf []string `json:"x-go-require-one-of"`
+	// GoHandwritten operations are implemented in client.go; they are
+	// checked by verify instead of being generated.
+	GoHandwritten bool `json:"x-go-handwritten"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref         string           `json:"$ref"`
+	Type        string           `json:"type"`
+	Format      string           `json:"format"`
+	Description string           `json:"description"`
+	Nullable    bool             `json:"nullable"`
+	Items       *schema          `json:"items"`
+	Properties  ordered[*schema] `json:"properties"`
+	Required    []string         `json:"required"`
+	AllOf       []*schema        `json:"allOf"`
+	Enum        []string         `json:"enum"`
+
+	GoType      string   `json:"x-go-type"`
+	GoExternal  bool     `json:"x-go-external"`
+	GoEnumNames []string `json:"x-go-enum-names"`
+}
+
+// ordered is a JSON object that keeps its key order, so generated code
+// follows the order of the schema file.
+type ordered[T any] struct {
+	Keys   []string
+	Values map[string]T
+}
+
+func (o *ordered[T]) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("expected object")
+	}
+	o.Values = make(map[string]T)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		o.Keys = append(o.Keys, key)
+		o.Values[key] = v
+	}
+	_, err := dec.Token()
+	return err
+}
+
+func parseSpec(data []byte) (*spec, []*operation, error) {
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, nil, fmt.Errorf("parse spec: %w", err)
+	}
+	var ops []*operation
+	for _, path := range s.Paths.Keys {
+		item := s.Paths.Values[path]
+		for _, method := range []string{"get", "put", "post", "patch", "delete"} {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			op := &operation{Method: strings.ToUpper(method), Path: path}
+			if err := json.Unmarshal(raw, op); err != nil {
+				return nil, nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if op.OperationID == "" {
+				return nil, nil, fmt.Errorf("%s %s: operationId is required", method, path)
+			}
+			ops = append(ops, op)
+		}
+	}
+	return &s, ops, nil
+}
+
+func (s *spec) resolve(sc *schema) (string, *schema, error) {
+	if sc == nil || sc.Ref == "" {
+		return "", sc, nil
+	}
+	name := strings.TrimPrefix(sc.Ref, "#/components/schemas/")
+	target, ok := s.Components.Schemas.Values[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown schema %s", sc.Ref)
+	}
+	return name, target, nil
+}
+
+func (op *operation) bodySchema() *schema {
+	if op.RequestBody == nil {
+		return nil
+	}
+	return op.RequestBody.Content["application/json"].Schema
+}
+
+func (op *operation) responseSchema() *schema {
+	resp, ok := op.Responses["200"]
+	if !ok {
+		return nil
+	}
+	return resp.Content["application/json"].Schema
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// verify checks the hand-written part of the package in dir against the
+// spec, so that it cannot drift from the schema either:
+//
+//   - every x-go-handwritten operation has a Client method of that name
+//     using the operation's HTTP method and path;
+//   - every exported Client method outside generated files that names an
+//     http.Method constant is an operation of the spec;
+//   - every x-go-external schema has a struct with the same JSON fields, and
+//     hand-written parameter structs have a field per parameter.
+func verify(data []byte, dir string) error {
+	s, ops, err := parseSpec(data)
+	if err != nil {
+		return err
+	}
+	pkg, err := parsePackage(dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	described := map[string]bool{}
+	for _, op := range ops {
+		described[op.OperationID] = true
+		if !op.GoHandwritten {
+			continue
+		}
+		if err := pkg.checkMethod(op); err != nil {
+			errs = append(errs, err)
+		}
+		if op.GoRequest != "" && op.bodySchema() == nil {
+			if err := pkg.checkParams(op); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for _, name := range sortedKeys(pkg.methods) {
+		if ast.IsExported(name) && !described[name] && usesHTTPMethod(pkg.methods[name]) {
+			errs = append(errs, fmt.Errorf("Client.%s calls the API but is not in the spec; describe it with x-go-handwritten", name))
+		}
+	}
+	for _, name := range s.Components.Schemas.Keys {
+		sc := s.Components.Schemas.Values[name]
+		if !sc.GoExternal || name == actionResult {
+			continue
+		}
+		if err := pkg.checkStruct(name, sc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handwritten is the non-generated source of the maxbot package.
+type handwritten struct {
+	methods map[string]*ast.FuncDecl
+	structs map[string]*ast.StructType
+}
+
+func parsePackage(dir string) (*handwritten, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &handwritten{methods: map[string]*ast.FuncDecl{}, structs: map[string]*ast.StructType{}}
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || strings.HasSuffix(path, "_gen.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if isClientMethod(d) {
+					pkg.methods[d.Name.Name] = d
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						if st, ok := ts.Type.(*ast.StructType); ok {
+							pkg.structs[ts.Name.Name] = st
+						}
+					}
+				}
+			}
+		}
+	}
+	return pkg, nil
+}
+
+func isClientMethod(d *ast.FuncDecl) bool {
+	if d.Recv == nil || len(d.Recv.List) != 1 || d.Body == nil {
+		return false
+	}
+	star, ok := d.Recv.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := star.X.(*ast.Ident)
+	return ok && ident.Name == "Client"
+}
+
+func (p *handwritten) checkMethod(op *operation) error {
+	fn, ok := p.methods[op.OperationID]
+	if !ok {
+		return fmt.Errorf("%s %s: no Client.%s method", op.Method, op.Path, op.OperationID)
+	}
+	method := "Method" + op.Method[:1] + strings.ToLower(op.Method[1:])
+	// Hand-written methods spell out the path up to the first parameter,
+	// possibly followed by a query string.
+	prefix, _, _ := strings.Cut(op.Path, "{")
+	var hasMethod, hasPath bool
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok && x.Name == "http" && n.Sel.Name == method {
+				hasMethod = true
+			}
+		case *ast.BasicLit:
+			if n.Kind == token.STRING {
+				if lit, err := strconv.Unquote(n.Value); err == nil && (lit == prefix || lit == prefix+"?") {
+					hasPath = true
+				}
+			}
+		}
+		return true
+	})
+	if !hasMethod || !hasPath {
+		return fmt.Errorf("Client.%s does not call %s %s as the spec says", op.OperationID, op.Method, op.Path)
+	}
+	return nil
+}
+
+func (p *handwritten) checkParams(op *operation) error {
+	st, ok := p.structs[op.GoRequest]
+	if !ok {
+		return fmt.Errorf("%s: no %s struct", op.OperationID, op.GoRequest)
+	}
+	fields := map[string]bool{}
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			fields[n.Name] = true
+		}
+	}
+	var missing []string
+	for _, param := range op.Parameters {
+		if !fields[goName(param.Name)] {
+			missing = append(missing, goName(param.Name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: %s lacks fields %v", op.OperationID, op.GoRequest, missing)
+	}
+	return nil
+}
+
+func (p *handwritten) checkStruct(name string, sc *schema) error {
+	st, ok := p.structs[name]
+	if !ok {
+		return fmt.Errorf("schema %s is x-go-external but no %s struct exists", name, name)
+	}
+	fields := map[string]bool{}
+	for _, f := range st.Fields.List {
+		if f.Tag == nil || len(f.Names) == 0 {
+			continue
+		}
+		tag, err := strconv.Unquote(f.Tag.Value)
+		if err != nil {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(reflect.StructTag(tag).Get("json"), ",")
+		if jsonName != "" && jsonName != "-" {
+			fields[jsonName] = true
+		}
+	}
+	var missing, extra []string
+	for _, prop := range sc.Properties.Keys {
+		if !fields[prop] {
+			missing = append(missing, prop)
+		}
+	}
+	for _, f := range sortedKeys(fields) {
+		if !slices.Contains(sc.Properties.Keys, f) {
+			extra = append(extra, f)
+		}
+	}
+	if len(missing) > 0 || len(extra) > 0 {
+		return fmt.Errorf("struct %s does not match schema %s: missing %v, not in schema %v", name, name, missing, extra)
+	}
+	return nil
+}
+
+func usesHTTPMethod(fn *ast.FuncDecl) bool {
+	found := false
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == "http" && strings.HasPrefix(sel.Sel.Name, "Method") {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
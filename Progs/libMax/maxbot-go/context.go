@@ -9,6 +9,8 @@ type Context struct {
 	ctx    context.Context
 	Client *Client
 	Update Update
+
+	timer *handlerTimer
 }
 
 func (c *Context) Context() context.Context {
@@ -45,6 +47,23 @@ func (c *Context) CallbackData() string {
 	return strings.TrimSpace(c.Update.Callback.Data)
 }
 
+func (c *Context) CallbackID() string {
+	if c.Update.Callback == nil {
+		return ""
+	}
+	return c.Update.Callback.ID
+}
+
+func (c *Context) MessageID() ID {
+	if c.Update.Message != nil {
+		return c.Update.Message.ID
+	}
+	if c.Update.Callback != nil && c.Update.Callback.Msg != nil {
+		return c.Update.Callback.Msg.ID
+	}
+	return ""
+}
+
 func (c *Context) Command() string {
 	if c.Update.Message == nil {
 		return ""
@@ -85,3 +104,42 @@ func (c *Context) Reply(text string) error {
 		Text:   text,
 	})
 }
+
+func (c *Context) ReplyWithKeyboard(text string, markup *InlineKeyboardMarkup) error {
+	chatID := c.ChatID()
+	if chatID == "" {
+		return nil
+	}
+	return c.Client.SendMessage(c.ctx, SendMessageRequest{
+		ChatID:      chatID,
+		Text:        text,
+		ReplyMarkup: markup,
+	})
+}
+
+// EditMessage rewrites the current message, or the message a callback
+// button belongs to.
+func (c *Context) EditMessage(text string, markup *InlineKeyboardMarkup) error {
+	chatID := c.ChatID()
+	messageID := c.MessageID()
+	if chatID == "" || messageID == "" {
+		return nil
+	}
+	return c.Client.EditMessageText(c.ctx, EditMessageTextRequest{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		Text:        text,
+		ReplyMarkup: markup,
+	})
+}
+
+func (c *Context) AnswerCallback(text string) error {
+	callbackID := c.CallbackID()
+	if callbackID == "" {
+		return nil
+	}
+	return c.Client.AnswerCallbackQuery(c.ctx, AnswerCallbackQueryRequest{
+		CallbackID: callbackID,
+		Text:       text,
+	})
+}
@@ -0,0 +1,268 @@
+package maxbot
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupWindow   = 10 * time.Minute
+	defaultDedupCapacity = 10000
+)
+
+// DedupStore remembers update keys for a sliding window. Claim must be
+// atomic across every process sharing the store (SET NX semantics), so that
+// overlapping pollers never both handle the same update.
+type DedupStore interface {
+	// Claim records key for ttl unless it is already recorded and not
+	// expired, and reports whether the caller claimed it.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Release forgets a claimed key so that a redelivery is handled again.
+	Release(ctx context.Context, key string) error
+}
+
+// Dedup returns a middleware that skips updates already handled within
+// window (10m when window <= 0). Updates are keyed by UpdateID, message ID
+// and callback ID. Keys are claimed before the handler runs and released if
+// it fails, so failed updates are processed again when redelivered. A
+// duplicate arriving in the same process while the first copy is still being
+// handled waits for its result. Store errors fail open: the update is
+// processed.
+func Dedup(store DedupStore, window time.Duration) Middleware {
+	return dedupMiddleware(store, window, nil)
+}
+
+// WithDedup installs the Dedup middleware ahead of middlewares added with Use.
+// Store errors are logged through the bot logger.
+func WithDedup(store DedupStore, window time.Duration) BotOption {
+	return func(b *Bot) {
+		if store == nil {
+			return
+		}
+		b.router.Use(dedupMiddleware(store, window, func(err error) {
+			b.logger.Errorf("dedup store failed: %v", err)
+		}))
+	}
+}
+
+// dedupCall is an update being handled; done is closed once ok is set.
+type dedupCall struct {
+	done chan struct{}
+	ok   bool
+}
+
+func dedupMiddleware(store DedupStore, window time.Duration, onErr func(error)) Middleware {
+	if window <= 0 {
+		window = defaultDedupWindow
+	}
+	report := func(err error) {
+		if onErr != nil {
+			onErr(err)
+		}
+	}
+	var (
+		mu       sync.Mutex
+		inflight = make(map[string]*dedupCall)
+	)
+	// enter registers keys as in flight, waiting for a concurrent copy of the
+	// update first. It returns nil when that copy was handled successfully.
+	enter := func(ctx context.Context, keys []string) (*dedupCall, error) {
+		for {
+			mu.Lock()
+			var running *dedupCall
+			for _, key := range keys {
+				if call, ok := inflight[key]; ok {
+					running = call
+					break
+				}
+			}
+			if running == nil {
+				call := &dedupCall{done: make(chan struct{})}
+				for _, key := range keys {
+					inflight[key] = call
+				}
+				mu.Unlock()
+				return call, nil
+			}
+			mu.Unlock()
+
+			select {
+			case <-running.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if running.ok {
+				return nil, nil
+			}
+		}
+	}
+	leave := func(call *dedupCall, keys []string, ok bool) {
+		mu.Lock()
+		for _, key := range keys {
+			if inflight[key] == call {
+				delete(inflight, key)
+			}
+		}
+		mu.Unlock()
+		call.ok = ok
+		close(call.done)
+	}
+	// unclaim releases store claims; it outlives a cancelled handler context.
+	unclaim := func(ctx context.Context, keys []string) {
+		ctx = context.WithoutCancel(ctx)
+		for _, key := range keys {
+			if err := store.Release(ctx, key); err != nil {
+				report(err)
+			}
+		}
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			keys := dedupKeys(c.Update)
+			if len(keys) == 0 {
+				return next(c)
+			}
+			ctx := c.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			call, err := enter(ctx, keys)
+			if err != nil {
+				return err
+			}
+			if call == nil {
+				return nil
+			}
+
+			var claimed []string
+			for _, key := range keys {
+				ok, err := store.Claim(ctx, key, window)
+				if err != nil {
+					report(err)
+					continue
+				}
+				if !ok {
+					unclaim(ctx, claimed)
+					leave(call, keys, true)
+					return nil
+				}
+				claimed = append(claimed, key)
+			}
+
+			if err := next(c); err != nil {
+				unclaim(ctx, claimed)
+				leave(call, keys, false)
+				return err
+			}
+			leave(call, keys, true)
+			return nil
+		}
+	}
+}
+
+func dedupKeys(upd Update) []string {
+	var keys []string
+	if upd.UpdateID != 0 {
+		keys = append(keys, "u:"+strconv.FormatInt(upd.UpdateID, 10))
+	}
+	if m := upd.Message; m != nil && m.ID != "" {
+		keys = append(keys, "m:"+string(m.Chat.ID)+":"+string(m.ID))
+	}
+	if cb := upd.Callback; cb != nil && cb.ID != "" {
+		keys = append(keys, "c:"+cb.ID)
+	}
+	return keys
+}
+
+// MemoryDedupStore is an in-process LRU DedupStore with per-key expiry.
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryDedupStore creates a store holding at most capacity keys
+// (10000 when capacity <= 0), evicting the least recently marked.
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = defaultDedupCapacity
+	}
+	return &MemoryDedupStore{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryDedupStore) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen(key) {
+		return false, nil
+	}
+	s.mark(key, time.Now().Add(ttl))
+	return true, nil
+}
+
+func (s *MemoryDedupStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(key)
+	return nil
+}
+
+func (s *MemoryDedupStore) seen(key string) bool {
+	el, ok := s.items[key]
+	if !ok {
+		return false
+	}
+	if time.Now().Before(el.Value.(*dedupEntry).expires) {
+		return true
+	}
+	s.order.Remove(el)
+	delete(s.items, key)
+	return false
+}
+
+func (s *MemoryDedupStore) mark(key string, expires time.Time) {
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+	}
+	s.items[key] = s.order.PushFront(&dedupEntry{key: key, expires: expires})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*dedupEntry).key)
+	}
+}
+
+func (s *MemoryDedupStore) forget(key string) {
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+		delete(s.items, key)
+	}
+}
+
+// live returns unexpired entries, oldest first.
+func (s *MemoryDedupStore) live() []dedupEntry {
+	now := time.Now()
+	out := make([]dedupEntry, 0, s.order.Len())
+	for el := s.order.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*dedupEntry)
+		if now.Before(e.expires) {
+			out = append(out, *e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package maxbot
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileDedupStore is a DedupStore that survives restarts by journaling keys
+// to a file. The journal is replayed on open and compacted as it grows.
+// Claims are only atomic within one process: do not share the journal
+// between processes; use a shared store such as Redis for that.
+type FileDedupStore struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	mem      *MemoryDedupStore
+	journal  int
+	capacity int
+}
+
+// OpenFileDedupStore opens or creates the journal at path. capacity bounds
+// the number of remembered keys as in NewMemoryDedupStore.
+func OpenFileDedupStore(path string, capacity int) (*FileDedupStore, error) {
+	mem := NewMemoryDedupStore(capacity)
+	s := &FileDedupStore{path: path, mem: mem, capacity: mem.capacity}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileDedupStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return false, errors.New("dedup store is closed")
+	}
+	s.mem.mu.Lock()
+	seen := s.mem.seen(key)
+	expires := time.Now().Add(ttl)
+	if !seen {
+		s.mem.mark(key, expires)
+	}
+	s.mem.mu.Unlock()
+	if seen {
+		return false, nil
+	}
+	return true, s.append("+" + strconv.FormatInt(expires.UnixNano(), 10) + "\t" + strconv.Quote(key))
+}
+
+func (s *FileDedupStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errors.New("dedup store is closed")
+	}
+	_ = s.mem.Release(ctx, key)
+	return s.append("-\t" + strconv.Quote(key))
+}
+
+// Close flushes and closes the journal.
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileDedupStore) append(line string) error {
+	if _, err := s.file.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("dedup journal write: %w", err)
+	}
+	s.journal++
+	if s.journal > 2*s.capacity {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *FileDedupStore) replay() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("dedup journal open: %w", err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		op, rest, ok := strings.Cut(sc.Text(), "\t")
+		if !ok || op == "" {
+			continue
+		}
+		key, err := strconv.Unquote(rest)
+		if err != nil {
+			continue
+		}
+		if op == "-" {
+			s.mem.forget(key)
+			continue
+		}
+		nanos, err := strconv.ParseInt(op[1:], 10, 64)
+		if err != nil || op[0] != '+' {
+			continue
+		}
+		expires := time.Unix(0, nanos)
+		if expires.After(now) {
+			s.mem.mark(key, expires)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("dedup journal read: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the journal with live entries only.
+func (s *FileDedupStore) compact() error {
+	s.mem.mu.Lock()
+	entries := s.mem.live()
+	s.mem.mu.Unlock()
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("dedup journal compact: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		fmt.Fprintf(w, "+%d\t%s\n", e.expires.UnixNano(), strconv.Quote(e.key))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("dedup journal compact: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("dedup journal compact: %w", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		// Keep appending to the old journal; it still holds every entry.
+		s.file, _ = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		return fmt.Errorf("dedup journal compact: %w", err)
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("dedup journal open: %w", err)
+	}
+	s.journal = len(entries)
+	return nil
+}
@@ -0,0 +1,211 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupSkipsRedeliveredUpdates(t *testing.T) {
+	b := NewBot(&Client{}, WithDedup(NewMemoryDedupStore(100), time.Minute))
+	calls := 0
+	b.HandleText(func(c *Context) error {
+		calls++
+		return nil
+	})
+
+	upd := Update{UpdateID: 7, Message: &Message{ID: "m1", Chat: Chat{ID: "1"}, Text: "hi"}}
+	for i := 0; i < 3; i++ {
+		if err := b.router.Dispatch(context.Background(), nil, upd); err != nil {
+			t.Fatalf("dispatch error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+
+	sameMessage := Update{UpdateID: 8, Message: &Message{ID: "m1", Chat: Chat{ID: "1"}, Text: "hi"}}
+	if err := b.router.Dispatch(context.Background(), nil, sameMessage); err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected message id to deduplicate across update ids, got %d calls", calls)
+	}
+
+	other := Update{UpdateID: 9, Message: &Message{ID: "m2", Chat: Chat{ID: "1"}, Text: "hi"}}
+	if err := b.router.Dispatch(context.Background(), nil, other); err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected new update to be processed, got %d calls", calls)
+	}
+}
+
+func TestDedupRetriesUpdatesWhoseHandlerFailed(t *testing.T) {
+	r := NewRouter()
+	r.Use(Dedup(NewMemoryDedupStore(10), time.Minute))
+	calls := 0
+	r.HandleText(func(c *Context) error {
+		calls++
+		if calls == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	upd := Update{UpdateID: 1, Message: &Message{Text: "hi"}}
+	if err := r.Dispatch(context.Background(), nil, upd); err == nil {
+		t.Fatal("expected first dispatch to fail")
+	}
+	if err := r.Dispatch(context.Background(), nil, upd); err != nil {
+		t.Fatalf("expected redelivery to be processed, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestDedupConcurrentDuplicateWaitsForFirstResult(t *testing.T) {
+	r := NewRouter()
+	r.Use(Dedup(NewMemoryDedupStore(10), time.Minute))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	r.HandleText(func(c *Context) error {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	upd := Update{UpdateID: 1, Message: &Message{Text: "hi"}}
+	first := make(chan error, 1)
+	go func() { first <- r.Dispatch(context.Background(), nil, upd) }()
+	<-started
+
+	second := make(chan error, 1)
+	go func() { second <- r.Dispatch(context.Background(), nil, upd) }()
+	select {
+	case err := <-second:
+		t.Fatalf("duplicate finished before the first copy: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-first; err == nil {
+		t.Fatal("expected first dispatch to fail")
+	}
+	if err := <-second; err != nil {
+		t.Fatalf("expected duplicate to be handled after the failure, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected 2 calls, got %d", n)
+	}
+	if err := r.Dispatch(context.Background(), nil, upd); err != nil || calls.Load() != 2 {
+		t.Fatalf("expected update to be marked after success, err=%v calls=%d", err, calls.Load())
+	}
+}
+
+func TestDedupSharedStoreSkipsUpdateClaimedByAnotherProcess(t *testing.T) {
+	store := NewMemoryDedupStore(10)
+	upd := Update{UpdateID: 9, Message: &Message{Text: "hi"}}
+
+	// Two routers stand in for two overlapping pollers sharing a store.
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	first := NewRouter()
+	first.Use(Dedup(store, time.Minute))
+	first.HandleText(func(c *Context) error {
+		close(started)
+		<-unblock
+		return nil
+	})
+	var second atomic.Int32
+	other := NewRouter()
+	other.Use(Dedup(store, time.Minute))
+	other.HandleText(func(c *Context) error {
+		second.Add(1)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- first.Dispatch(context.Background(), nil, upd) }()
+	<-started
+	if err := other.Dispatch(context.Background(), nil, upd); err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	if n := second.Load(); n != 0 {
+		t.Fatalf("expected the second poller to skip the claimed update, got %d calls", n)
+	}
+}
+
+func TestMemoryDedupStoreWindowAndCapacity(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryDedupStore(2)
+
+	if ok, _ := s.Claim(ctx, "a", 20*time.Millisecond); !ok {
+		t.Fatal("expected to claim an unseen key")
+	}
+	if ok, _ := s.Claim(ctx, "a", time.Minute); ok {
+		t.Fatal("expected claimed key to be held within window")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := s.Claim(ctx, "a", time.Minute); !ok {
+		t.Fatal("expected key to be claimable after window")
+	}
+	_ = s.Release(ctx, "a")
+	if ok, _ := s.Claim(ctx, "a", time.Minute); !ok {
+		t.Fatal("expected released key to be claimable")
+	}
+
+	s.Claim(ctx, "b", time.Minute)
+	s.Claim(ctx, "c", time.Minute)
+	if ok, _ := s.Claim(ctx, "a", time.Minute); !ok {
+		t.Fatal("expected oldest key to be evicted at capacity")
+	}
+}
+
+func TestFileDedupStoreSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.log")
+
+	s, err := OpenFileDedupStore(path, 3)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore error: %v", err)
+	}
+	for _, key := range []string{"u:1", "u:2", "u:3", "u:4", "u:5", "u:6", "u:7", "u:8"} {
+		if _, err := s.Claim(ctx, key, time.Minute); err != nil {
+			t.Fatalf("Claim error: %v", err)
+		}
+	}
+	if err := s.Release(ctx, "u:7"); err != nil {
+		t.Fatalf("Release error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	s, err = OpenFileDedupStore(path, 3)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	defer s.Close()
+	if ok, _ := s.Claim(ctx, "u:8", time.Minute); ok {
+		t.Fatal("expected recent key to survive reopen")
+	}
+	if ok, _ := s.Claim(ctx, "u:7", time.Minute); !ok {
+		t.Fatal("expected released key to stay released after reopen")
+	}
+	if ok, _ := s.Claim(ctx, "u:1", time.Minute); !ok {
+		t.Fatal("expected evicted key to be gone")
+	}
+}
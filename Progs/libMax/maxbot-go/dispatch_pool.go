@@ -0,0 +1,120 @@
+package maxbot
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultBackgroundWorkers   = 4
+	defaultBackgroundQueueSize = 256
+)
+
+// dispatchPool processes updates on a fixed set of workers. Updates of the
+// same chat always land on the same worker, so they are handled in order.
+type dispatchPool struct {
+	dispatch func(context.Context, Update) error
+	onError  func(error, Update)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	queues []chan Update
+	wg     sync.WaitGroup
+	next   atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newDispatchPool(workers, queueSize int, dispatch func(context.Context, Update) error, onError func(error, Update)) *dispatchPool {
+	if workers <= 0 {
+		workers = defaultBackgroundWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultBackgroundQueueSize
+	}
+	perWorker := queueSize / workers
+	if perWorker < 1 {
+		perWorker = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &dispatchPool{
+		dispatch: dispatch,
+		onError:  onError,
+		ctx:      ctx,
+		cancel:   cancel,
+		queues:   make([]chan Update, workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan Update, perWorker)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+func (p *dispatchPool) work(queue <-chan Update) {
+	defer p.wg.Done()
+	for upd := range queue {
+		if err := p.dispatch(p.ctx, upd); err != nil && p.onError != nil {
+			p.onError(err, upd)
+		}
+	}
+}
+
+// Enqueue schedules upd and reports false when the pool is closed or the
+// target worker's queue is full.
+func (p *dispatchPool) Enqueue(upd Update) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.queues[p.shard(upd)] <- upd:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *dispatchPool) shard(upd Update) int {
+	chatID := (&Context{Update: upd}).ChatID()
+	if chatID == "" {
+		return int(p.next.Add(1) % uint64(len(p.queues)))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(chatID))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// Drain stops accepting updates and waits for queued ones to finish. When
+// ctx expires first, the dispatch context is cancelled so in-flight and
+// still queued updates fail fast, and ctx.Err() is returned.
+func (p *dispatchPool) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, q := range p.queues {
+			close(q)
+		}
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
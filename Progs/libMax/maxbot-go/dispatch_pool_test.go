@@ -0,0 +1,113 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func chatUpdate(id int64, chat string) Update {
+	return Update{UpdateID: id, Message: &Message{Chat: Chat{ID: ID(chat)}, Text: fmt.Sprint(id)}}
+}
+
+func TestDispatchPoolKeepsPerChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[ID][]int64)
+	p := newDispatchPool(4, 64, func(ctx context.Context, upd Update) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[upd.Message.Chat.ID] = append(seen[upd.Message.Chat.ID], upd.UpdateID)
+		mu.Unlock()
+		return nil
+	}, nil)
+
+	for i := int64(1); i <= 10; i++ {
+		for _, chat := range []string{"a", "b", "c"} {
+			if !p.Enqueue(chatUpdate(i, chat)) {
+				t.Fatalf("enqueue %d/%s rejected", i, chat)
+			}
+		}
+	}
+	if err := p.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain error: %v", err)
+	}
+
+	for chat, ids := range seen {
+		if len(ids) != 10 {
+			t.Fatalf("chat %s: expected 10 updates, got %v", chat, ids)
+		}
+		for i, id := range ids {
+			if id != int64(i+1) {
+				t.Fatalf("chat %s: out of order updates %v", chat, ids)
+			}
+		}
+	}
+	if p.Enqueue(chatUpdate(11, "a")) {
+		t.Fatal("expected enqueue after drain to be rejected")
+	}
+}
+
+func TestDispatchPoolRejectsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	p := newDispatchPool(1, 1, func(ctx context.Context, upd Update) error {
+		<-release
+		return nil
+	}, nil)
+
+	accepted := 0
+	for i := int64(1); i <= 5; i++ {
+		if p.Enqueue(chatUpdate(i, "a")) {
+			accepted++
+		}
+	}
+	if accepted < 1 || accepted > 2 {
+		t.Fatalf("expected 1-2 accepted updates with a queue of 1, got %d", accepted)
+	}
+	close(release)
+	if err := p.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain error: %v", err)
+	}
+}
+
+func TestDispatchPoolDrainDeadlineCancelsHandlers(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	started := make(chan struct{})
+	p := newDispatchPool(1, 4, func(ctx context.Context, upd Update) error {
+		if upd.UpdateID == 1 {
+			close(started)
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(err error, upd Update) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	p.Enqueue(chatUpdate(1, "a"))
+	p.Enqueue(chatUpdate(2, "a"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(errs)
+		mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			if n != 2 {
+				t.Fatalf("expected both updates reported as aborted, got %d", n)
+			}
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,52 @@
+package maxbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Endpoint methods and their types are generated from api/openapi.json
+// into endpoints_gen.go and types_gen.go.
+//go:generate go run ./cmd/maxbot-gen
+
+// doAction performs a call answered with {"success": bool, "message": ...}
+// and turns "success": false into an *APIError.
+func (c *Client) doAction(ctx context.Context, method, path string, payload any) error {
+	body, err := c.do(ctx, method, path, payload)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Success *bool  `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	if result.Success == nil {
+		return fmt.Errorf("decode %s %s response: missing success field", method, path)
+	}
+	if *result.Success {
+		return nil
+	}
+	return &APIError{StatusCode: http.StatusOK, Message: result.Message, Body: strings.TrimSpace(string(body))}
+}
+
+func withQuery(path string, q url.Values) string {
+	if qs := q.Encode(); qs != "" {
+		return path + "?" + qs
+	}
+	return path
+}
+
+func joinIDs(ids []ID) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = string(id)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,235 @@
+// Code generated by maxbot-gen from api/openapi.json. DO NOT EDIT.
+
+package maxbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func (c *Client) GetMe(ctx context.Context) (*BotInfo, error) {
+	body, err := c.do(ctx, http.MethodGet, "/me", nil)
+	if err != nil {
+		return nil, err
+	}
+	var out BotInfo
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decode bot info response: %w", err)
+	}
+	return &out, nil
+}
+
+// ListChats returns one page of the chats the bot is a member of. Pass the
+// returned Marker to fetch the next page.
+func (c *Client) ListChats(ctx context.Context, opts ListChatsOptions) (*ChatList, error) {
+	q := url.Values{}
+	if opts.Count > 0 {
+		q.Set("count", strconv.Itoa(opts.Count))
+	}
+	if opts.Marker != 0 {
+		q.Set("marker", strconv.FormatInt(opts.Marker, 10))
+	}
+	path := withQuery("/chats", q)
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ChatList
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decode chat list response: %w", err)
+	}
+	return &out, nil
+}
+
+func (c *Client) GetChat(ctx context.Context, chatID ID) (*Chat, error) {
+	if strings.TrimSpace(string(chatID)) == "" {
+		return nil, fmt.Errorf("get chat: chat id is required")
+	}
+	path := "/chats/" + url.PathEscape(string(chatID))
+	ctx = withRoute(ctx, "/chats/{chat_id}")
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Chat
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decode chat response: %w", err)
+	}
+	return &out, nil
+}
+
+// GetChatMembers returns one page of chat members, or the given UserIDs.
+func (c *Client) GetChatMembers(ctx context.Context, opts GetChatMembersOptions) (*ChatMemberList, error) {
+	if strings.TrimSpace(string(opts.ChatID)) == "" {
+		return nil, fmt.Errorf("get chat members: chat id is required")
+	}
+	q := url.Values{}
+	if len(opts.UserIDs) > 0 {
+		q.Set("user_ids", joinIDs(opts.UserIDs))
+	}
+	if opts.Count > 0 {
+		q.Set("count", strconv.Itoa(opts.Count))
+	}
+	if opts.Marker != 0 {
+		q.Set("marker", strconv.FormatInt(opts.Marker, 10))
+	}
+	path := withQuery("/chats/"+url.PathEscape(string(opts.ChatID))+"/members", q)
+	ctx = withRoute(ctx, "/chats/{chat_id}/members")
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ChatMemberList
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decode chat member list response: %w", err)
+	}
+	return &out, nil
+}
+
+func (c *Client) AddMembers(ctx context.Context, req AddMembersRequest) error {
+	if strings.TrimSpace(string(req.ChatID)) == "" {
+		return fmt.Errorf("add members: chat id is required")
+	}
+	if len(req.UserIDs) == 0 {
+		return fmt.Errorf("add members: user ids are required")
+	}
+	path := "/chats/" + url.PathEscape(string(req.ChatID)) + "/members"
+	ctx = withRoute(ctx, "/chats/{chat_id}/members")
+	return c.doAction(ctx, http.MethodPost, path, req)
+}
+
+func (c *Client) RemoveMember(ctx context.Context, req RemoveMemberRequest) error {
+	if strings.TrimSpace(string(req.ChatID)) == "" {
+		return fmt.Errorf("remove member: chat id is required")
+	}
+	if strings.TrimSpace(string(req.UserID)) == "" {
+		return fmt.Errorf("remove member: user id is required")
+	}
+	q := url.Values{}
+	q.Set("user_id", string(req.UserID))
+	if req.Block {
+		q.Set("block", "true")
+	}
+	path := withQuery("/chats/"+url.PathEscape(string(req.ChatID))+"/members", q)
+	ctx = withRoute(ctx, "/chats/{chat_id}/members")
+	return c.doAction(ctx, http.MethodDelete, path, nil)
+}
+
+func (c *Client) GetAdmins(ctx context.Context, chatID ID) ([]ChatMember, error) {
+	if strings.TrimSpace(string(chatID)) == "" {
+		return nil, fmt.Errorf("get admins: chat id is required")
+	}
+	path := "/chats/" + url.PathEscape(string(chatID)) + "/members/admins"
+	ctx = withRoute(ctx, "/chats/{chat_id}/members/admins")
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var wrapped struct {
+		Members []ChatMember `json:"members"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("decode members response: %w", err)
+	}
+	return wrapped.Members, nil
+}
+
+func (c *Client) PinMessage(ctx context.Context, req PinMessageRequest) error {
+	if strings.TrimSpace(string(req.ChatID)) == "" {
+		return fmt.Errorf("pin message: chat id is required")
+	}
+	if strings.TrimSpace(string(req.MessageID)) == "" {
+		return fmt.Errorf("pin message: message id is required")
+	}
+	path := "/chats/" + url.PathEscape(string(req.ChatID)) + "/pin"
+	ctx = withRoute(ctx, "/chats/{chat_id}/pin")
+	return c.doAction(ctx, http.MethodPut, path, req)
+}
+
+func (c *Client) UnpinMessage(ctx context.Context, chatID ID) error {
+	if strings.TrimSpace(string(chatID)) == "" {
+		return fmt.Errorf("unpin message: chat id is required")
+	}
+	path := "/chats/" + url.PathEscape(string(chatID)) + "/pin"
+	ctx = withRoute(ctx, "/chats/{chat_id}/pin")
+	return c.doAction(ctx, http.MethodDelete, path, nil)
+}
+
+func (c *Client) LeaveChat(ctx context.Context, chatID ID) error {
+	if strings.TrimSpace(string(chatID)) == "" {
+		return fmt.Errorf("leave chat: chat id is required")
+	}
+	path := "/chats/" + url.PathEscape(string(chatID)) + "/members/me"
+	ctx = withRoute(ctx, "/chats/{chat_id}/members/me")
+	return c.doAction(ctx, http.MethodDelete, path, nil)
+}
+
+// GetMessages returns messages of a chat, or the given MessageIDs.
+func (c *Client) GetMessages(ctx context.Context, opts GetMessagesOptions) ([]Message, error) {
+	if strings.TrimSpace(string(opts.ChatID)) == "" && len(opts.MessageIDs) == 0 {
+		return nil, fmt.Errorf("get messages: chat id or message ids are required")
+	}
+	q := url.Values{}
+	if opts.ChatID != "" {
+		q.Set("chat_id", string(opts.ChatID))
+	}
+	if len(opts.MessageIDs) > 0 {
+		q.Set("message_ids", joinIDs(opts.MessageIDs))
+	}
+	if opts.From != 0 {
+		q.Set("from", strconv.FormatInt(opts.From, 10))
+	}
+	if opts.To != 0 {
+		q.Set("to", strconv.FormatInt(opts.To, 10))
+	}
+	if opts.Count > 0 {
+		q.Set("count", strconv.Itoa(opts.Count))
+	}
+	path := withQuery("/messages", q)
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var wrapped struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("decode messages response: %w", err)
+	}
+	return wrapped.Messages, nil
+}
+
+func (c *Client) GetMessage(ctx context.Context, messageID ID) (*Message, error) {
+	if strings.TrimSpace(string(messageID)) == "" {
+		return nil, fmt.Errorf("get message: message id is required")
+	}
+	path := "/messages/" + url.PathEscape(string(messageID))
+	ctx = withRoute(ctx, "/messages/{message_id}")
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decode message response: %w", err)
+	}
+	return &out, nil
+}
+
+// SendAction shows an action such as ActionTypingOn to chat members.
+func (c *Client) SendAction(ctx context.Context, req SendActionRequest) error {
+	if strings.TrimSpace(string(req.ChatID)) == "" {
+		return fmt.Errorf("send action: chat id is required")
+	}
+	if req.Action == "" {
+		return fmt.Errorf("send action: action is required")
+	}
+	path := "/chats/" + url.PathEscape(string(req.ChatID)) + "/actions"
+	ctx = withRoute(ctx, "/chats/{chat_id}/actions")
+	return c.doAction(ctx, http.MethodPost, path, req)
+}
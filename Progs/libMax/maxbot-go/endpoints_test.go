@@ -0,0 +1,214 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeEndpointAPI struct {
+	mu        sync.Mutex
+	responses map[string]string // "METHOD /path" -> JSON body
+	requests  []string          // "METHOD /path?query body"
+}
+
+func newFakeEndpointAPI(t *testing.T, responses map[string]string) (*fakeEndpointAPI, *Client) {
+	t.Helper()
+	api := &fakeEndpointAPI{responses: responses}
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		api.mu.Lock()
+		api.requests = append(api.requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+strings.TrimSpace(string(raw))))
+		resp, ok := api.responses[r.Method+" "+r.URL.Path]
+		api.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"not.found","message":"unknown endpoint"}`))
+			return
+		}
+		_, _ = w.Write([]byte(resp))
+	}, ClientConfig{})
+	return api, c
+}
+
+func (api *fakeEndpointAPI) last(t *testing.T) string {
+	t.Helper()
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.requests) == 0 {
+		t.Fatal("expected a request")
+	}
+	return api.requests[len(api.requests)-1]
+}
+
+func TestChatEndpoints(t *testing.T) {
+	const ok = `{"success":true}`
+	api, c := newFakeEndpointAPI(t, map[string]string{
+		"GET /me":                      `{"user_id":7,"name":"Bot","username":"demo_bot","is_bot":true,"commands":[{"name":"start"}]}`,
+		"GET /chats":                   `{"chats":[{"chat_id":42,"title":"Team","type":"chat","participants_count":3}],"marker":99}`,
+		"GET /chats/42":                `{"chat_id":42,"title":"Team","owner_id":1,"is_public":true}`,
+		"GET /chats/42/members":        `{"members":[{"user_id":1,"name":"Ann","is_owner":true}],"marker":5}`,
+		"POST /chats/42/members":       ok,
+		"DELETE /chats/42/members":     ok,
+		"GET /chats/42/members/admins": `{"members":[{"user_id":1,"is_admin":true,"permissions":["pin_message"]}]}`,
+		"PUT /chats/42/pin":            ok,
+		"DELETE /chats/42/pin":         ok,
+		"DELETE /chats/42/members/me":  ok,
+		"POST /chats/42/actions":       ok,
+	})
+	ctx := context.Background()
+
+	me, err := c.GetMe(ctx)
+	if err != nil {
+		t.Fatalf("GetMe error: %v", err)
+	}
+	if me.ID != "7" || me.Username != "demo_bot" || !me.IsBot || len(me.Commands) != 1 {
+		t.Fatalf("unexpected bot info %+v", me)
+	}
+
+	chats, err := c.ListChats(ctx, ListChatsOptions{Count: 10, Marker: 3})
+	if err != nil {
+		t.Fatalf("ListChats error: %v", err)
+	}
+	if got := api.last(t); got != "GET /chats?count=10&marker=3" {
+		t.Fatalf("unexpected request %q", got)
+	}
+	if len(chats.Chats) != 1 || chats.Chats[0].ID != "42" || chats.Chats[0].ParticipantsCount != 3 || chats.Marker != 99 {
+		t.Fatalf("unexpected chats %+v", chats)
+	}
+
+	chat, err := c.GetChat(ctx, "42")
+	if err != nil {
+		t.Fatalf("GetChat error: %v", err)
+	}
+	if chat.Title != "Team" || chat.OwnerID != "1" || !chat.IsPublic {
+		t.Fatalf("unexpected chat %+v", chat)
+	}
+
+	members, err := c.GetChatMembers(ctx, GetChatMembersOptions{ChatID: "42", UserIDs: []ID{"1", "2"}, Count: 20})
+	if err != nil {
+		t.Fatalf("GetChatMembers error: %v", err)
+	}
+	if got := api.last(t); got != "GET /chats/42/members?count=20&user_ids=1%2C2" {
+		t.Fatalf("unexpected request %q", got)
+	}
+	if len(members.Members) != 1 || members.Members[0].Name != "Ann" || !members.Members[0].IsOwner || members.Marker != 5 {
+		t.Fatalf("unexpected members %+v", members)
+	}
+
+	admins, err := c.GetAdmins(ctx, "42")
+	if err != nil {
+		t.Fatalf("GetAdmins error: %v", err)
+	}
+	if len(admins) != 1 || !admins[0].IsAdmin || admins[0].Permissions[0] != "pin_message" {
+		t.Fatalf("unexpected admins %+v", admins)
+	}
+
+	notify := false
+	pin := PinMessageRequest{ChatID: "42", MessageID: "m1", Notify: &notify}
+	calls := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{"AddMembers", func() error { return c.AddMembers(ctx, AddMembersRequest{ChatID: "42", UserIDs: []ID{"5", "6"}}) }, `POST /chats/42/members {"user_ids":["5","6"]}`},
+		{"RemoveMember", func() error { return c.RemoveMember(ctx, RemoveMemberRequest{ChatID: "42", UserID: "5", Block: true}) }, `DELETE /chats/42/members?block=true&user_id=5`},
+		{"PinMessage", func() error { return c.PinMessage(ctx, pin) }, `PUT /chats/42/pin {"message_id":"m1","notify":false}`},
+		{"UnpinMessage", func() error { return c.UnpinMessage(ctx, "42") }, `DELETE /chats/42/pin`},
+		{"LeaveChat", func() error { return c.LeaveChat(ctx, "42") }, `DELETE /chats/42/members/me`},
+		{"SendAction", func() error { return c.SendAction(ctx, SendActionRequest{ChatID: "42", Action: ActionTypingOn}) }, `POST /chats/42/actions {"action":"typing_on"}`},
+	}
+	for _, tc := range calls {
+		if err := tc.call(); err != nil {
+			t.Fatalf("%s error: %v", tc.name, err)
+		}
+		if got := api.last(t); got != tc.want {
+			t.Fatalf("%s: unexpected request %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMessageEndpoints(t *testing.T) {
+	api, c := newFakeEndpointAPI(t, map[string]string{
+		"GET /messages":    `{"messages":[{"message_id":"m1","chat":{"chat_id":42},"text":"hi"},{"message_id":"m2","chat":{"chat_id":42}}]}`,
+		"GET /messages/m1": `{"message_id":"m1","chat":{"chat_id":42},"sender":{"user_id":1},"text":"hi"}`,
+	})
+	ctx := context.Background()
+
+	msgs, err := c.GetMessages(ctx, GetMessagesOptions{ChatID: "42", From: 100, To: 200, Count: 2})
+	if err != nil {
+		t.Fatalf("GetMessages error: %v", err)
+	}
+	if got := api.last(t); got != "GET /messages?chat_id=42&count=2&from=100&to=200" {
+		t.Fatalf("unexpected request %q", got)
+	}
+	if len(msgs) != 2 || msgs[0].Text != "hi" || msgs[1].Chat.ID != "42" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if _, err := c.GetMessages(ctx, GetMessagesOptions{MessageIDs: []ID{"m1", "m2"}}); err != nil {
+		t.Fatalf("GetMessages error: %v", err)
+	}
+	if got := api.last(t); got != "GET /messages?message_ids=m1%2Cm2" {
+		t.Fatalf("unexpected request %q", got)
+	}
+
+	msg, err := c.GetMessage(ctx, "m1")
+	if err != nil {
+		t.Fatalf("GetMessage error: %v", err)
+	}
+	if msg.ID != "m1" || msg.Sender == nil || msg.Sender.ID != "1" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if _, err := c.GetMessage(ctx, "missing"); !IsNotFound(err) {
+		t.Fatalf("expected not-found error, got %v", err)
+	}
+}
+
+func TestEndpointValidationAndUnsuccessfulResult(t *testing.T) {
+	api, c := newFakeEndpointAPI(t, map[string]string{
+		"DELETE /chats/42/members/me": `{"success":false,"message":"owner cannot leave the chat"}`,
+	})
+	ctx := context.Background()
+
+	err := c.LeaveChat(ctx, "42")
+	if err == nil || !strings.Contains(err.Error(), "owner cannot leave") {
+		t.Fatalf("expected success=false to be reported, got %v", err)
+	}
+
+	for name, call := range map[string]func() error{
+		"GetChat":      func() error { _, err := c.GetChat(ctx, ""); return err },
+		"AddMembers":   func() error { return c.AddMembers(ctx, AddMembersRequest{ChatID: "42"}) },
+		"RemoveMember": func() error { return c.RemoveMember(ctx, RemoveMemberRequest{ChatID: "42"}) },
+		"PinMessage":   func() error { return c.PinMessage(ctx, PinMessageRequest{ChatID: "42"}) },
+		"SendAction":   func() error { return c.SendAction(ctx, SendActionRequest{ChatID: "42"}) },
+		"GetMessages":  func() error { _, err := c.GetMessages(ctx, GetMessagesOptions{}); return err },
+	} {
+		if err := call(); err == nil {
+			t.Fatalf("%s: expected validation error", name)
+		}
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.requests) != 1 {
+		t.Fatalf("expected invalid calls not to reach the API, got %v", api.requests)
+	}
+}
+
+func TestActionEndpointRejectsUndecodableResult(t *testing.T) {
+	_, c := newFakeEndpointAPI(t, map[string]string{
+		"DELETE /chats/1/members/me": `not json`,
+		"DELETE /chats/2/members/me": `{"message":"ok"}`,
+	})
+	ctx := context.Background()
+	for _, chat := range []ID{"1", "2"} {
+		err := c.LeaveChat(ctx, chat)
+		var apiErr *APIError
+		if err == nil || errors.As(err, &apiErr) || !strings.Contains(err.Error(), "decode") {
+			t.Fatalf("chat %s: expected a decode error, got %v", chat, err)
+		}
+	}
+}
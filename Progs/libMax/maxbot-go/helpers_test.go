@@ -0,0 +1,37 @@
+package maxbot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestServer starts h and closes it when the test ends.
+func newTestServer(t *testing.T, h http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// newTestClient returns a client for baseURL with the other settings from
+// cfg. Client-side rate limiting is off unless cfg sets RateLimitRPS.
+func newTestClient(t *testing.T, baseURL string, cfg ClientConfig) *Client {
+	t.Helper()
+	cfg.Token = "test-token"
+	cfg.BaseURL = baseURL
+	if cfg.RateLimitRPS == 0 {
+		cfg.RateLimitRPS = -1
+	}
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	return c
+}
+
+// newTestAPI serves h and returns a client for it.
+func newTestAPI(t *testing.T, h http.HandlerFunc, cfg ClientConfig) *Client {
+	t.Helper()
+	return newTestClient(t, newTestServer(t, h).URL, cfg)
+}
@@ -0,0 +1,131 @@
+package maxbot
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const defaultIdempotencyWindow = 10 * time.Minute
+
+type idempotencyKey struct{}
+
+type idempotency struct {
+	key string
+	// auto keys are generated per call; they protect retries only and are
+	// not remembered by the send cache.
+	auto bool
+}
+
+// WithIdempotencyKey attaches key to requests made with ctx. It is sent as
+// the Idempotency-Key header, lets POST requests be retried after server
+// errors, and makes a repeated successful POST with the same key and payload
+// within ClientConfig.IdempotencyWindow a no-op. Other methods are always
+// sent.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, idempotency{key: key})
+}
+
+func idempotencyFrom(ctx context.Context) idempotency {
+	v, _ := ctx.Value(idempotencyKey{}).(idempotency)
+	return v
+}
+
+// sendContext prepares ctx for a message send: a caller-supplied key (the
+// request field wins over the context) or a fresh one.
+func sendContext(ctx context.Context, chatID ID, key string) context.Context {
+	ctx = withRateLimitKey(ctx, chatID)
+	if key != "" {
+		return WithIdempotencyKey(ctx, key)
+	}
+	if idempotencyFrom(ctx).key != "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKey{}, idempotency{key: newIdempotencyKey(), auto: true})
+}
+
+func newIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// sendCache remembers successful requests by idempotency key and payload
+// for a window and collapses concurrent identical requests into one.
+type sendCache struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*sendEntry
+	// expiry holds completed entries oldest first; the window is fixed, so
+	// this is also expiry order.
+	expiry *list.List
+}
+
+type sendEntry struct {
+	key     string
+	done    chan struct{}
+	body    []byte
+	err     error
+	expires time.Time
+}
+
+func newSendCache(window time.Duration) *sendCache {
+	return &sendCache{window: window, entries: make(map[string]*sendEntry), expiry: list.New()}
+}
+
+// sendCacheKey identifies a request by method, path, payload and
+// idempotency key, so reusing a key for a different message sends it.
+func sendCacheKey(method, path string, payload []byte, key string) string {
+	sum := sha256.Sum256(payload)
+	return method + " " + path + " " + hex.EncodeToString(sum[:]) + " " + key
+}
+
+func (s *sendCache) do(ctx context.Context, key string, send func() ([]byte, error)) ([]byte, error) {
+	s.mu.Lock()
+	s.evict(time.Now())
+	if e, ok := s.entries[key]; ok {
+		s.mu.Unlock()
+		select {
+		case <-e.done:
+			return e.body, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	e := &sendEntry{key: key, done: make(chan struct{})}
+	s.entries[key] = e
+	s.mu.Unlock()
+
+	e.body, e.err = send()
+
+	s.mu.Lock()
+	if e.err != nil {
+		// Failed sends are forgotten so a later call can try again.
+		delete(s.entries, key)
+	} else {
+		e.expires = time.Now().Add(s.window)
+		s.expiry.PushBack(e)
+	}
+	s.mu.Unlock()
+	close(e.done)
+	return e.body, e.err
+}
+
+// evict drops expired entries from the front of the expiry list.
+func (s *sendCache) evict(now time.Time) {
+	for el := s.expiry.Front(); el != nil; el = s.expiry.Front() {
+		e := el.Value.(*sendEntry)
+		if !now.After(e.expires) {
+			return
+		}
+		s.expiry.Remove(el)
+		if s.entries[e.key] == e {
+			delete(s.entries, e.key)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type idempotencyServer struct {
+	mu     sync.Mutex
+	keys   []string
+	bodies []string
+	fail   map[int]int // attempt number -> status
+	delay  time.Duration
+}
+
+func newIdempotencyServer(t *testing.T, cfg ClientConfig, fail map[int]int) (*idempotencyServer, *Client) {
+	t.Helper()
+	s := &idempotencyServer{fail: fail}
+	cfg.DisableAdaptiveThrottling = true
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.keys = append(s.keys, r.Header.Get(IdempotencyKeyHeader))
+		s.bodies = append(s.bodies, string(raw))
+		n := len(s.keys)
+		status := s.fail[n]
+		delay := s.delay
+		s.mu.Unlock()
+		time.Sleep(delay)
+		if status != 0 {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"message":"fail"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}, cfg)
+	return s, c
+}
+
+func (s *idempotencyServer) calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.keys...)
+}
+
+func TestSendMessageGeneratesStableIdempotencyKey(t *testing.T) {
+	s, c := newIdempotencyServer(t, ClientConfig{MaxRetries: 1, InitialBackoff: time.Millisecond}, map[int]int{1: http.StatusTooManyRequests})
+	ctx := context.Background()
+
+	if err := c.SendMessage(ctx, SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+	if err := c.SendMessage(ctx, SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+	keys := s.calls()
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(keys))
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("expected the same key across retries, got %v", keys)
+	}
+	if keys[2] == keys[0] {
+		t.Fatalf("expected a new key for a new send, got %v", keys)
+	}
+	if strings.Contains(s.bodies[0], "idempotency") || strings.Contains(s.bodies[0], "Idempotency") {
+		t.Fatalf("key leaked into body: %s", s.bodies[0])
+	}
+}
+
+func TestRepeatedSendWithSameKeyIsNoop(t *testing.T) {
+	s, c := newIdempotencyServer(t, ClientConfig{}, map[int]int{1: http.StatusBadRequest})
+	ctx := context.Background()
+	req := SendMessageRequest{ChatID: "1", Text: "hi", IdempotencyKey: "order-42"}
+
+	if err := c.SendMessage(ctx, req); err == nil {
+		t.Fatal("expected first send to fail")
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.SendMessage(ctx, req); err != nil {
+			t.Fatalf("SendMessage error: %v", err)
+		}
+	}
+	if err := c.SendMessage(WithIdempotencyKey(ctx, "order-42"), SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+	if err := c.SendMessage(ctx, SendMessageRequest{ChatID: "1", Text: "hi", IdempotencyKey: "order-43"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+
+	want := []string{"order-42", "order-42", "order-43"}
+	keys := s.calls()
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected requests %v (failed send retried, later repeats skipped), got %v", want, keys)
+	}
+}
+
+func TestConcurrentSendsWithSameKeyCollapse(t *testing.T) {
+	s, c := newIdempotencyServer(t, ClientConfig{}, nil)
+	s.delay = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	var failures atomic.Int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.SendMessage(context.Background(), SendMessageRequest{ChatID: "1", Text: "hi", IdempotencyKey: "k"}); err != nil {
+				failures.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(s.calls()); n != 1 || failures.Load() != 0 {
+		t.Fatalf("expected one request and no failures, got %d requests, %d failures", n, failures.Load())
+	}
+}
+
+func TestIdempotencyCacheDisabledAndExpiring(t *testing.T) {
+	s, c := newIdempotencyServer(t, ClientConfig{IdempotencyWindow: -1}, nil)
+	req := SendMessageRequest{ChatID: "1", Text: "hi", IdempotencyKey: "k"}
+	_ = c.SendMessage(context.Background(), req)
+	_ = c.SendMessage(context.Background(), req)
+	if n := len(s.calls()); n != 2 {
+		t.Fatalf("expected cache to be disabled, got %d requests", n)
+	}
+
+	s, c = newIdempotencyServer(t, ClientConfig{IdempotencyWindow: 20 * time.Millisecond}, nil)
+	_ = c.SendMessage(context.Background(), req)
+	time.Sleep(40 * time.Millisecond)
+	_ = c.SendMessage(context.Background(), req)
+	if n := len(s.calls()); n != 2 {
+		t.Fatalf("expected send to repeat after the window, got %d requests", n)
+	}
+}
+
+func TestKeyedGetIsNotCached(t *testing.T) {
+	s, c := newIdempotencyServer(t, ClientConfig{}, nil)
+	ctx := WithIdempotencyKey(context.Background(), "k")
+	for i := 0; i < 2; i++ {
+		if _, err := c.Do(ctx, http.MethodGet, "/me", nil); err != nil {
+			t.Fatalf("Do error: %v", err)
+		}
+	}
+	if calls := s.calls(); len(calls) != 2 {
+		t.Fatalf("expected both GETs to reach the server, got %d", len(calls))
+	}
+}
+
+func TestSameKeyWithDifferentPayloadIsSent(t *testing.T) {
+	s, c := newIdempotencyServer(t, ClientConfig{}, nil)
+	ctx := context.Background()
+	for _, chat := range []ID{"1", "2", "1"} {
+		if err := c.SendMessage(ctx, SendMessageRequest{ChatID: chat, Text: "hi", IdempotencyKey: "k"}); err != nil {
+			t.Fatalf("SendMessage error: %v", err)
+		}
+	}
+	if n := len(s.calls()); n != 2 {
+		t.Fatalf("expected one request per distinct payload, got %d", n)
+	}
+}
+
+func TestSendCacheWaiterHonorsContext(t *testing.T) {
+	cache := newSendCache(time.Minute)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_, _ = cache.do(context.Background(), "k", func() ([]byte, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+	}()
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cache.do(ctx, "k", func() ([]byte, error) { return nil, nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected waiter to give up with its context, got %v", err)
+	}
+}
+
+func TestSendCacheEvictsExpiredEntriesInOrder(t *testing.T) {
+	cache := newSendCache(10 * time.Millisecond)
+	ctx := context.Background()
+	ok := func() ([]byte, error) { return nil, nil }
+	_, _ = cache.do(ctx, "a", ok)
+	_, _ = cache.do(ctx, "b", ok)
+	time.Sleep(20 * time.Millisecond)
+	_, _ = cache.do(ctx, "c", ok)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if len(cache.entries) != 1 || cache.expiry.Len() != 1 || cache.entries["c"] == nil {
+		t.Fatalf("expected only the fresh entry to remain, got %d entries", len(cache.entries))
+	}
+}
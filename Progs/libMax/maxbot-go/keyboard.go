@@ -0,0 +1,48 @@
+package maxbot
+
+// InlineKeyboardBuilder assembles an InlineKeyboardMarkup row by row.
+type InlineKeyboardBuilder struct {
+	rows    [][]InlineKeyboardButton
+	current []InlineKeyboardButton
+}
+
+func NewInlineKeyboard() *InlineKeyboardBuilder {
+	return &InlineKeyboardBuilder{}
+}
+
+// Button appends a callback button to the current row.
+func (b *InlineKeyboardBuilder) Button(text, callbackData string) *InlineKeyboardBuilder {
+	b.current = append(b.current, InlineKeyboardButton{Text: text, CallbackData: callbackData})
+	return b
+}
+
+// URLButton appends a link button to the current row.
+func (b *InlineKeyboardBuilder) URLButton(text, url string) *InlineKeyboardBuilder {
+	b.current = append(b.current, InlineKeyboardButton{Text: text, URL: url})
+	return b
+}
+
+// Add appends prebuilt buttons to the current row.
+func (b *InlineKeyboardBuilder) Add(buttons ...InlineKeyboardButton) *InlineKeyboardBuilder {
+	b.current = append(b.current, buttons...)
+	return b
+}
+
+// Row closes the current row; empty rows are skipped.
+func (b *InlineKeyboardBuilder) Row() *InlineKeyboardBuilder {
+	if len(b.current) > 0 {
+		b.rows = append(b.rows, b.current)
+		b.current = nil
+	}
+	return b
+}
+
+// Build returns the keyboard, or nil when no buttons were added so that
+// ReplyMarkup is omitted from the request.
+func (b *InlineKeyboardBuilder) Build() *InlineKeyboardMarkup {
+	b.Row()
+	if len(b.rows) == 0 {
+		return nil
+	}
+	return &InlineKeyboardMarkup{InlineKeyboard: b.rows}
+}
@@ -0,0 +1,27 @@
+package maxbot
+
+import "testing"
+
+func TestInlineKeyboardBuilderRows(t *testing.T) {
+	markup := NewInlineKeyboard().
+		Button("A", "a").
+		Button("B", "b").
+		Row().
+		Row().
+		URLButton("Site", "https://example.test").
+		Build()
+
+	if len(markup.InlineKeyboard) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(markup.InlineKeyboard))
+	}
+	if len(markup.InlineKeyboard[0]) != 2 || markup.InlineKeyboard[0][1].CallbackData != "b" {
+		t.Fatalf("unexpected first row: %+v", markup.InlineKeyboard[0])
+	}
+	if markup.InlineKeyboard[1][0].URL != "https://example.test" {
+		t.Fatalf("unexpected second row: %+v", markup.InlineKeyboard[1])
+	}
+
+	if empty := NewInlineKeyboard().Row().Build(); empty != nil {
+		t.Fatalf("expected nil keyboard without buttons, got %+v", empty.InlineKeyboard)
+	}
+}
@@ -0,0 +1,70 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultShutdownHookTimeout = 10 * time.Second
+
+// LifecycleHook runs when a runtime starts or stops.
+type LifecycleHook func(ctx context.Context) error
+
+// OnStartup registers a hook run by StartLongPolling and StartWebhook before
+// any update is received. Hooks run in registration order; the first error
+// aborts the start.
+func (b *Bot) OnStartup(hook LifecycleHook) {
+	if hook != nil {
+		b.startupHooks = append(b.startupHooks, hook)
+	}
+}
+
+// OnShutdown registers a hook run after the runtime has stopped and drained
+// in-flight updates. Hooks run in reverse registration order, share one
+// deadline (WithShutdownHookTimeout) and all run even if some fail.
+func (b *Bot) OnShutdown(hook LifecycleHook) {
+	if hook != nil {
+		b.shutdownHooks = append(b.shutdownHooks, hook)
+	}
+}
+
+// WithShutdownHookTimeout bounds the total time of OnShutdown hooks
+// (default 10s).
+func WithShutdownHookTimeout(d time.Duration) BotOption {
+	return func(b *Bot) {
+		if d > 0 {
+			b.shutdownHookTimeout = d
+		}
+	}
+}
+
+func (b *Bot) runStartupHooks(ctx context.Context) error {
+	for i, hook := range b.startupHooks {
+		if err := hook(ctx); err != nil {
+			b.logger.Errorf("startup hook %d failed: %v", i, err)
+			return fmt.Errorf("startup hook %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// runShutdownHooks runs the shutdown hooks with a fresh deadline, since the
+// runtime context is usually already cancelled at this point.
+func (b *Bot) runShutdownHooks() error {
+	if len(b.shutdownHooks) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.shutdownHookTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(b.shutdownHooks) - 1; i >= 0; i-- {
+		if err := b.shutdownHooks[i](ctx); err != nil {
+			b.logger.Errorf("shutdown hook %d failed: %v", i, err)
+			errs = append(errs, fmt.Errorf("shutdown hook %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLifecycleHooksRunAroundLongPolling(t *testing.T) {
+	c := newPollingTestClient(t, `{"updates":[{"update_id":1,"message":{"text":"hi"}}]}`)
+	b := NewBot(c)
+
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	handled := make(chan struct{})
+	b.OnStartup(func(context.Context) error { record("start1"); return nil })
+	b.OnStartup(func(context.Context) error { record("start2"); return nil })
+	b.OnShutdown(func(context.Context) error { record("stop1"); return nil })
+	b.OnShutdown(func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected shutdown hook deadline")
+		}
+		record("stop2")
+		return nil
+	})
+	b.HandleText(func(c *Context) error {
+		record("handle")
+		close(handled)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.StartLongPolling(ctx) }()
+	<-handled
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	want := "start1,start2,handle,stop2,stop1"
+	if got := strings.Join(events, ","); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestStartupHookErrorAbortsStart(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"updates":[]}`))
+	}, ClientConfig{})
+
+	b := NewBot(c)
+	boom := errors.New("boom")
+	secondCalled := false
+	b.OnStartup(func(context.Context) error { return boom })
+	b.OnStartup(func(context.Context) error { secondCalled = true; return nil })
+
+	if err := b.StartLongPolling(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("expected startup error, got %v", err)
+	}
+	if err := b.StartWebhook(context.Background(), WebhookOptions{Addr: "127.0.0.1:0"}); !errors.Is(err, boom) {
+		t.Fatalf("expected startup error from webhook, got %v", err)
+	}
+	if secondCalled || requests.Load() != 0 {
+		t.Fatalf("expected start to abort (second=%v requests=%d)", secondCalled, requests.Load())
+	}
+}
+
+func TestShutdownHookErrorsAreReturned(t *testing.T) {
+	c := newPollingTestClient(t, `{"updates":[]}`)
+	b := NewBot(c, WithShutdownHookTimeout(time.Second))
+	started := make(chan struct{})
+	b.OnStartup(func(context.Context) error { close(started); return nil })
+	first, second := errors.New("first"), errors.New("second")
+	b.OnShutdown(func(context.Context) error { return first })
+	b.OnShutdown(func(context.Context) error { return second })
+
+	done := make(chan error, 1)
+	go func() { done <- b.StartLongPolling(context.Background()) }()
+	<-started
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+	err := <-done
+	if !errors.Is(err, first) || !errors.Is(err, second) {
+		t.Fatalf("expected both hook errors, got %v", err)
+	}
+}
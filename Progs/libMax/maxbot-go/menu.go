@@ -0,0 +1,198 @@
+package maxbot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const defaultMenuBackText = "« Back"
+
+// MenuNode is one screen of a Menu. A node with Children or Items renders as
+// a submenu; a node with only Action runs it when selected.
+type MenuNode struct {
+	// ID identifies the node in callback payloads. Empty IDs are derived from
+	// the node's position in the tree; the node itself is not modified, so a
+	// tree may be shared between menus.
+	ID    string
+	Title string
+	// Text is the message body shown for the node; TextFunc overrides it.
+	Text     string
+	TextFunc func(*Context) (string, error)
+	Children []*MenuNode
+	// Items returns dynamic buttons rendered after Children. Selecting one
+	// calls OnItem with its Value and re-renders the node.
+	Items  func(*Context) ([]MenuItem, error)
+	OnItem func(c *Context, value string) error
+	Action Handler
+}
+
+// MenuItem is a dynamic button produced by MenuNode.Items.
+type MenuItem struct {
+	Text  string
+	Value string
+}
+
+// Menu renders a MenuNode tree into inline keyboards and handles navigation
+// and "Back" by editing the original message.
+type Menu struct {
+	// BackText labels the button that returns to the parent node.
+	BackText string
+
+	root    *MenuNode
+	nodes   map[string]*MenuNode
+	ids     map[*MenuNode]string
+	parents map[string]string
+	cd      *CallbackData[menuCallback]
+}
+
+type menuCallback struct {
+	Node string `callback:"n"`
+	Item string `callback:"i"`
+}
+
+// NewMenu validates the tree under root and creates a menu whose callbacks
+// use prefix. opts configure the underlying callback codec.
+func NewMenu(prefix string, root *MenuNode, opts ...CallbackDataOption) (*Menu, error) {
+	if root == nil {
+		return nil, errors.New("menu: root node is required")
+	}
+	cd, err := NewCallbackData[menuCallback](prefix, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("menu: %w", err)
+	}
+	m := &Menu{
+		BackText: defaultMenuBackText,
+		root:     root,
+		nodes:    make(map[string]*MenuNode),
+		ids:      make(map[*MenuNode]string),
+		parents:  make(map[string]string),
+		cd:       cd,
+	}
+	if err := m.index(root, "", "r"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Menu) index(n *MenuNode, parentID, path string) error {
+	id := n.ID
+	if id == "" {
+		id = path
+	}
+	if _, dup := m.nodes[id]; dup {
+		return fmt.Errorf("menu: duplicate node id %q", id)
+	}
+	if _, dup := m.ids[n]; dup {
+		return fmt.Errorf("menu: node %q appears twice in the tree", id)
+	}
+	m.nodes[id] = n
+	m.ids[n] = id
+	if parentID != "" {
+		m.parents[id] = parentID
+	}
+	for i, child := range n.Children {
+		if child == nil {
+			return fmt.Errorf("menu: node %q has nil child %d", id, i)
+		}
+		if err := m.index(child, id, path+"."+strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register installs the menu's callback handler on r.
+func (m *Menu) Register(r CallbackRouter) {
+	r.HandleCallbackPrefix(m.cd.Prefix(), m.handle)
+}
+
+// Send replies with a new message showing the root node.
+func (m *Menu) Send(c *Context) error {
+	text, markup, err := m.Render(c, m.ids[m.root])
+	if err != nil {
+		return err
+	}
+	return c.ReplyWithKeyboard(text, markup)
+}
+
+// Render builds the text and keyboard for the node with the given id.
+func (m *Menu) Render(c *Context, id string) (string, *InlineKeyboardMarkup, error) {
+	n, ok := m.nodes[id]
+	if !ok {
+		return "", nil, fmt.Errorf("menu: unknown node %q", id)
+	}
+
+	text := n.Text
+	if n.TextFunc != nil {
+		var err error
+		if text, err = n.TextFunc(c); err != nil {
+			return "", nil, err
+		}
+	}
+	if text == "" {
+		text = n.Title
+	}
+
+	kb := NewInlineKeyboard()
+	for _, child := range n.Children {
+		kb.Button(child.Title, m.cd.MustPack(menuCallback{Node: m.ids[child]})).Row()
+	}
+	if n.Items != nil {
+		items, err := n.Items(c)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, item := range items {
+			data, err := m.cd.Pack(menuCallback{Node: id, Item: item.Value})
+			if err != nil {
+				return "", nil, fmt.Errorf("menu: item %q: %w", item.Value, err)
+			}
+			kb.Button(item.Text, data).Row()
+		}
+	}
+	if parentID, ok := m.parents[id]; ok {
+		kb.Button(m.BackText, m.cd.MustPack(menuCallback{Node: parentID}))
+	}
+	return text, kb.Build(), nil
+}
+
+func (m *Menu) handle(c *Context) error {
+	nav, err := m.cd.UnpackContext(c.Context(), c.CallbackData())
+	if err != nil {
+		return err
+	}
+	n, ok := m.nodes[nav.Node]
+	if !ok {
+		return fmt.Errorf("%w: unknown menu node %q", ErrInvalidCallbackData, nav.Node)
+	}
+
+	switch {
+	case nav.Item != "":
+		if n.OnItem != nil {
+			if err := n.OnItem(c, nav.Item); err != nil {
+				return err
+			}
+		}
+		if err := m.edit(c, nav.Node); err != nil {
+			return err
+		}
+	case n.Action != nil && len(n.Children) == 0 && n.Items == nil:
+		if err := n.Action(c); err != nil {
+			return err
+		}
+	default:
+		if err := m.edit(c, nav.Node); err != nil {
+			return err
+		}
+	}
+	return c.AnswerCallback("")
+}
+
+func (m *Menu) edit(c *Context, id string) error {
+	text, markup, err := m.Render(c, id)
+	if err != nil {
+		return err
+	}
+	return c.EditMessage(text, markup)
+}
@@ -0,0 +1,177 @@
+package maxbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func callbackFor(t *testing.T, body map[string]any, text string) string {
+	t.Helper()
+	raw, _ := json.Marshal(body["reply_markup"])
+	var markup InlineKeyboardMarkup
+	if err := json.Unmarshal(raw, &markup); err != nil {
+		t.Fatalf("decode reply_markup: %v", err)
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, btn := range row {
+			if btn.Text == text {
+				return btn.CallbackData
+			}
+		}
+	}
+	t.Fatalf("button %q not found in %+v", text, markup)
+	return ""
+}
+
+func TestMenuNavigationAndBack(t *testing.T) {
+	client, requests := newRecordingClient(t)
+	lang := "en"
+	actionCalled := false
+	menu, err := NewMenu("settings", &MenuNode{
+		Title: "Settings",
+		Children: []*MenuNode{
+			{
+				Title:    "Language",
+				TextFunc: func(*Context) (string, error) { return "Current: " + lang, nil },
+				Items: func(*Context) ([]MenuItem, error) {
+					return []MenuItem{{Text: "English", Value: "en"}, {Text: "Русский", Value: "ru"}}, nil
+				},
+				OnItem: func(c *Context, value string) error {
+					lang = value
+					return nil
+				},
+			},
+			{
+				Title:  "Reset",
+				Action: func(*Context) error { actionCalled = true; return nil },
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMenu error: %v", err)
+	}
+	r := NewRouter()
+	menu.Register(r)
+
+	c := &Context{ctx: context.Background(), Client: client, Update: Update{Message: &Message{Chat: Chat{ID: "42"}}}}
+	if err := menu.Send(c); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	click := func(data string) {
+		t.Helper()
+		err := r.Dispatch(context.Background(), client, Update{Callback: &CallbackQuery{
+			ID:   "cb",
+			Data: data,
+			Msg:  &Message{ID: "m1", Chat: Chat{ID: "42"}},
+		}})
+		if err != nil {
+			t.Fatalf("dispatch error: %v", err)
+		}
+	}
+	last := func() recordedRequest {
+		reqs := requests()
+		for i := len(reqs) - 1; i >= 0; i-- {
+			if reqs[i].Path == "/messages" {
+				return reqs[i]
+			}
+		}
+		t.Fatal("no message request recorded")
+		return recordedRequest{}
+	}
+
+	root := last()
+	if root.Body["text"] != "Settings" {
+		t.Fatalf("unexpected root text: %v", root.Body["text"])
+	}
+
+	click(callbackFor(t, root.Body, "Language"))
+	sub := last()
+	if sub.Method != http.MethodPatch || sub.Body["text"] != "Current: en" {
+		t.Fatalf("unexpected submenu edit: %+v", sub)
+	}
+
+	click(callbackFor(t, sub.Body, "Русский"))
+	if lang != "ru" {
+		t.Fatalf("expected OnItem to set lang, got %q", lang)
+	}
+	if got := last().Body["text"]; got != "Current: ru" {
+		t.Fatalf("expected re-rendered node, got %v", got)
+	}
+
+	click(callbackFor(t, sub.Body, "« Back"))
+	if got := last().Body["text"]; got != "Settings" {
+		t.Fatalf("expected back to root, got %v", got)
+	}
+
+	edits := len(requests())
+	click(callbackFor(t, root.Body, "Reset"))
+	if !actionCalled {
+		t.Fatal("expected leaf action to run")
+	}
+	if reqs := requests(); len(reqs) != edits+1 || reqs[len(reqs)-1].Path != "/callbacks/answer" {
+		t.Fatalf("expected leaf action to only answer callback, got %+v", reqs[edits:])
+	}
+}
+
+func TestNewMenuRejectsDuplicateIDs(t *testing.T) {
+	_, err := NewMenu("m", &MenuNode{
+		Title:    "root",
+		Children: []*MenuNode{{ID: "a"}, {ID: "a"}},
+	})
+	if err == nil {
+		t.Fatal("expected duplicate id error")
+	}
+}
+
+func TestMenuRejectsUnknownNode(t *testing.T) {
+	menu, err := NewMenu("m", &MenuNode{Title: "root"})
+	if err != nil {
+		t.Fatalf("NewMenu error: %v", err)
+	}
+	r := NewRouter()
+	menu.Register(r)
+
+	data := menu.cd.MustPack(menuCallback{Node: "ghost"})
+	err = r.Dispatch(context.Background(), nil, Update{Callback: &CallbackQuery{Data: data}})
+	if err == nil {
+		t.Fatal("expected error for unknown node")
+	}
+	if _, _, err := menu.Render(&Context{}, "ghost"); err == nil {
+		t.Fatal("expected Render error for unknown node")
+	}
+}
+
+func TestMenuSharedTreeIsNotModified(t *testing.T) {
+	leaf := &MenuNode{Title: "Leaf", Action: func(*Context) error { return nil }}
+	root := &MenuNode{Title: "Root", Children: []*MenuNode{leaf}}
+	first, err := NewMenu("one", root)
+	if err != nil {
+		t.Fatalf("NewMenu error: %v", err)
+	}
+	second, err := NewMenu("two", &MenuNode{Title: "Other", Children: []*MenuNode{{ID: "r.0", Title: "Taken"}, root}})
+	if err != nil {
+		t.Fatalf("NewMenu with shared subtree error: %v", err)
+	}
+	if root.ID != "" || leaf.ID != "" {
+		t.Fatalf("expected caller nodes to keep empty IDs, got %q %q", root.ID, leaf.ID)
+	}
+	for _, tc := range []struct {
+		menu *Menu
+		id   string
+	}{{first, "r"}, {first, "r.0"}, {second, "r.1"}, {second, "r.1.0"}} {
+		if _, _, err := tc.menu.Render(&Context{}, tc.id); err != nil {
+			t.Fatalf("Render %s error: %v", tc.id, err)
+		}
+	}
+	_, markup, _ := first.Render(&Context{}, "r")
+	if nav, err := first.cd.Unpack(markup.InlineKeyboard[0][0].CallbackData); err != nil || nav.Node != "r.0" {
+		t.Fatalf("expected first menu to keep its own ids, got %+v %v", nav, err)
+	}
+
+	if _, err := NewMenu("loop", &MenuNode{Title: "Root", Children: []*MenuNode{leaf, leaf}}); err == nil {
+		t.Fatal("expected error for a node used twice in one tree")
+	}
+}
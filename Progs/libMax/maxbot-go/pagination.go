@@ -0,0 +1,108 @@
+package maxbot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Page is one rendered page of a paginated list.
+type Page struct {
+	Text string
+	// Buttons are extra item buttons rendered one per row above navigation.
+	Buttons []InlineKeyboardButton
+	// Total is the number of pages; navigation is hidden when it is <= 1.
+	Total int
+}
+
+// PageLoader loads the 1-based page for the current update.
+type PageLoader func(c *Context, page int) (Page, error)
+
+// Paginator renders a list page with "◀ 1/7 ▶" navigation and handles its
+// own navigation callbacks by editing the message in place.
+type Paginator struct {
+	load PageLoader
+	cd   *CallbackData[pageCallback]
+}
+
+type pageCallback struct {
+	Page int  `callback:"p"`
+	Noop bool `callback:"n"`
+}
+
+// NewPaginator creates a paginator whose navigation callbacks use prefix.
+// opts configure the underlying callback codec (signing, overflow store).
+func NewPaginator(prefix string, load PageLoader, opts ...CallbackDataOption) (*Paginator, error) {
+	if load == nil {
+		return nil, errors.New("paginator: page loader is required")
+	}
+	cd, err := NewCallbackData[pageCallback](prefix, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("paginator: %w", err)
+	}
+	return &Paginator{load: load, cd: cd}, nil
+}
+
+// Register installs the navigation callback handler on r.
+func (p *Paginator) Register(r CallbackRouter) {
+	r.HandleCallbackPrefix(p.cd.Prefix(), p.handle)
+}
+
+// Render loads page and builds its text and keyboard. page is clamped to
+// the range reported by the loader.
+func (p *Paginator) Render(c *Context, page int) (string, *InlineKeyboardMarkup, error) {
+	if page < 1 {
+		page = 1
+	}
+	pg, err := p.load(c, page)
+	if err != nil {
+		return "", nil, err
+	}
+	if pg.Total > 0 && page > pg.Total {
+		page = pg.Total
+		if pg, err = p.load(c, page); err != nil {
+			return "", nil, err
+		}
+	}
+
+	kb := NewInlineKeyboard()
+	for _, btn := range pg.Buttons {
+		kb.Add(btn).Row()
+	}
+	if pg.Total > 1 {
+		if page > 1 {
+			kb.Button("◀", p.cd.MustPack(pageCallback{Page: page - 1}))
+		}
+		kb.Button(strconv.Itoa(page)+"/"+strconv.Itoa(pg.Total), p.cd.MustPack(pageCallback{Page: page, Noop: true}))
+		if page < pg.Total {
+			kb.Button("▶", p.cd.MustPack(pageCallback{Page: page + 1}))
+		}
+	}
+	return pg.Text, kb.Build(), nil
+}
+
+// Send replies with a new message showing page.
+func (p *Paginator) Send(c *Context, page int) error {
+	text, markup, err := p.Render(c, page)
+	if err != nil {
+		return err
+	}
+	return c.ReplyWithKeyboard(text, markup)
+}
+
+func (p *Paginator) handle(c *Context) error {
+	nav, err := p.cd.UnpackContext(c.Context(), c.CallbackData())
+	if err != nil {
+		return err
+	}
+	if !nav.Noop {
+		text, markup, err := p.Render(c, nav.Page)
+		if err != nil {
+			return err
+		}
+		if err := c.EditMessage(text, markup); err != nil {
+			return err
+		}
+	}
+	return c.AnswerCallback("")
+}
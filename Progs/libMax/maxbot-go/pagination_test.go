@@ -0,0 +1,171 @@
+package maxbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   map[string]any
+}
+
+func newRecordingClient(t *testing.T) (*Client, func() []recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var reqs []recordedRequest
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		_ = json.Unmarshal(raw, &body)
+		mu.Lock()
+		reqs = append(reqs, recordedRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}, ClientConfig{})
+	return c, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), reqs...)
+	}
+}
+
+func keyboardTexts(t *testing.T, body map[string]any) [][]string {
+	t.Helper()
+	raw, _ := json.Marshal(body["reply_markup"])
+	var markup InlineKeyboardMarkup
+	if err := json.Unmarshal(raw, &markup); err != nil {
+		t.Fatalf("decode reply_markup: %v", err)
+	}
+	var out [][]string
+	for _, row := range markup.InlineKeyboard {
+		var texts []string
+		for _, btn := range row {
+			texts = append(texts, btn.Text)
+		}
+		out = append(out, texts)
+	}
+	return out
+}
+
+func TestPaginatorSendAndNavigate(t *testing.T) {
+	client, requests := newRecordingClient(t)
+	p, err := NewPaginator("orders", func(c *Context, page int) (Page, error) {
+		return Page{
+			Text:    fmt.Sprintf("page %d", page),
+			Buttons: []InlineKeyboardButton{{Text: fmt.Sprintf("item %d", page), CallbackData: "item"}},
+			Total:   3,
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewPaginator error: %v", err)
+	}
+	bot := NewBot(client)
+	p.Register(bot)
+
+	c := &Context{ctx: context.Background(), Client: client, Update: Update{Message: &Message{Chat: Chat{ID: "42"}}}}
+	if err := p.Send(c, 1); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	sent := requests()[0]
+	if sent.Method != http.MethodPost || sent.Path != "/messages" || sent.Body["text"] != "page 1" {
+		t.Fatalf("unexpected send request: %+v", sent)
+	}
+	rows := keyboardTexts(t, sent.Body)
+	if len(rows) != 2 || rows[0][0] != "item 1" || fmt.Sprint(rows[1]) != "[1/3 ▶]" {
+		t.Fatalf("unexpected first page keyboard: %v", rows)
+	}
+
+	raw, _ := json.Marshal(sent.Body["reply_markup"])
+	var markup InlineKeyboardMarkup
+	_ = json.Unmarshal(raw, &markup)
+	next := markup.InlineKeyboard[1][1].CallbackData
+
+	err = bot.router.Dispatch(context.Background(), client, Update{Callback: &CallbackQuery{
+		ID:   "cb1",
+		Data: next,
+		Msg:  &Message{ID: "m1", Chat: Chat{ID: "42"}},
+	}})
+	if err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+
+	reqs := requests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected edit and answer requests, got %+v", reqs)
+	}
+	edit := reqs[1]
+	if edit.Method != http.MethodPatch || edit.Path != "/messages" || edit.Body["message_id"] != "m1" || edit.Body["text"] != "page 2" {
+		t.Fatalf("unexpected edit request: %+v", edit)
+	}
+	if rows := keyboardTexts(t, edit.Body); fmt.Sprint(rows[1]) != "[◀ 2/3 ▶]" {
+		t.Fatalf("unexpected second page keyboard: %v", rows)
+	}
+	if reqs[2].Path != "/callbacks/answer" || reqs[2].Body["callback_id"] != "cb1" {
+		t.Fatalf("unexpected answer request: %+v", reqs[2])
+	}
+}
+
+func TestPaginatorCounterButtonOnlyAnswers(t *testing.T) {
+	client, requests := newRecordingClient(t)
+	p, err := NewPaginator("orders", func(c *Context, page int) (Page, error) {
+		return Page{Text: "x", Total: 2}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewPaginator error: %v", err)
+	}
+	r := NewRouter()
+	p.Register(r)
+
+	err = r.Dispatch(context.Background(), client, Update{Callback: &CallbackQuery{
+		ID:   "cb1",
+		Data: p.cd.MustPack(pageCallback{Page: 1, Noop: true}),
+		Msg:  &Message{ID: "m1", Chat: Chat{ID: "42"}},
+	}})
+	if err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	reqs := requests()
+	if len(reqs) != 1 || reqs[0].Path != "/callbacks/answer" {
+		t.Fatalf("expected only callback answer, got %+v", reqs)
+	}
+}
+
+func TestPaginatorRenderClampsAndHidesNavigation(t *testing.T) {
+	p, err := NewPaginator("list", func(c *Context, page int) (Page, error) {
+		return Page{Text: fmt.Sprintf("page %d", page), Total: 2}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewPaginator error: %v", err)
+	}
+	text, markup, err := p.Render(&Context{}, 9)
+	if err != nil {
+		t.Fatalf("Render error: %v", err)
+	}
+	if text != "page 2" || len(markup.InlineKeyboard[0]) != 2 {
+		t.Fatalf("unexpected clamped render: %q %+v", text, markup)
+	}
+
+	single, _ := NewPaginator("one", func(c *Context, page int) (Page, error) {
+		return Page{Text: "only", Total: 1}, nil
+	})
+	_, markup, _ = single.Render(&Context{}, 1)
+	if markup != nil {
+		t.Fatalf("expected no keyboard for single page, got %+v", markup.InlineKeyboard)
+	}
+
+	client, requests := newRecordingClient(t)
+	c := &Context{ctx: context.Background(), Client: client, Update: Update{Message: &Message{Chat: Chat{ID: "42"}}}}
+	if err := single.Send(c, 1); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if _, ok := requests()[0].Body["reply_markup"]; ok {
+		t.Fatalf("expected reply_markup to be omitted, got %+v", requests()[0].Body)
+	}
+}
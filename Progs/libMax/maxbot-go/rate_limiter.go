@@ -0,0 +1,204 @@
+package maxbot
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitBurst     = 30
+	defaultChatRateLimitBurst = 5
+
+	// chatBucketSweepSize is the number of per-chat buckets after which
+	// idle (full) buckets are dropped.
+	chatBucketSweepSize = 1024
+)
+
+// RateLimiter paces outgoing API requests. key is the chat ID for message
+// sends and empty for everything else. Implementations must be safe for
+// concurrent use. Limiters that also have an RPS() float64 method report
+// their global rate to the client's adaptive throttle.
+type RateLimiter interface {
+	Wait(ctx context.Context, key string) error
+}
+
+// limiterRPS returns the global rate reported by l, or 0 when unknown.
+func limiterRPS(l RateLimiter) float64 {
+	if r, ok := l.(interface{ RPS() float64 }); ok {
+		return r.RPS()
+	}
+	return 0
+}
+
+// RateLimitConfig configures NewRateLimiter. Rates are tokens per second
+// and may be fractional, e.g. 20.0/60 for 20 messages a minute. The global
+// limit defaults to 30 rps with burst 30 and is disabled by a negative RPS.
+// The per-chat limit is off unless ChatRPS is positive; ChatBurst then
+// defaults to 5.
+type RateLimitConfig struct {
+	RPS       float64
+	Burst     int
+	ChatRPS   float64
+	ChatBurst int
+}
+
+// TokenBucketLimiter is the default RateLimiter: a global token bucket plus
+// one bucket per chat for message sends. Waiters do not block each other
+// while sleeping.
+type TokenBucketLimiter struct {
+	global *tokenBucket
+
+	chatRPS   float64
+	chatBurst int
+	mu        sync.Mutex
+	chats     map[string]*tokenBucket
+}
+
+// NewRateLimiter creates a TokenBucketLimiter.
+func NewRateLimiter(cfg RateLimitConfig) *TokenBucketLimiter {
+	rps := cfg.RPS
+	if rps == 0 {
+		rps = defaultRateLimitRPS
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = defaultRateLimitBurst
+	}
+	chatBurst := cfg.ChatBurst
+	if chatBurst <= 0 {
+		chatBurst = defaultChatRateLimitBurst
+	}
+	return newTokenBucketLimiter(rps, burst, cfg.ChatRPS, chatBurst)
+}
+
+// newTokenBucketLimiter builds a limiter; a rate <= 0 disables the
+// corresponding bucket.
+func newTokenBucketLimiter(rps float64, burst int, chatRPS float64, chatBurst int) *TokenBucketLimiter {
+	l := &TokenBucketLimiter{chatRPS: chatRPS, chatBurst: chatBurst}
+	if rps > 0 {
+		l.global = newTokenBucket(rps, burst)
+	}
+	if chatRPS > 0 {
+		l.chats = make(map[string]*tokenBucket)
+	}
+	return l
+}
+
+// Wait takes a token from the chat bucket (for non-empty key) and from the
+// global bucket, sleeping until both are available. If the wait is cancelled
+// no token is kept.
+func (l *TokenBucketLimiter) Wait(ctx context.Context, key string) error {
+	var chat *tokenBucket
+	if key != "" && l.chats != nil {
+		chat = l.chat(key)
+		if err := chat.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l.global != nil {
+		if err := l.global.wait(ctx); err != nil {
+			if chat != nil {
+				chat.refund()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// RPS returns the global rate, or 0 when the global limit is disabled.
+func (l *TokenBucketLimiter) RPS() float64 {
+	if l.global == nil {
+		return 0
+	}
+	return l.global.rate
+}
+
+func (l *TokenBucketLimiter) chat(key string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.chats[key]; ok {
+		return b
+	}
+	if len(l.chats) >= chatBucketSweepSize {
+		now := time.Now()
+		for k, b := range l.chats {
+			if b.idle(now) {
+				delete(l.chats, k)
+			}
+		}
+	}
+	b := newTokenBucket(l.chatRPS, l.chatBurst)
+	l.chats[key] = b
+	return b
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// wait reserves a token, possibly driving the balance negative, and sleeps
+// off the deficit without holding the lock. A cancelled wait returns its
+// token.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	b.refill(time.Now())
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if err := sleepWithContext(ctx, delay); err != nil {
+		b.refund()
+		return err
+	}
+	return nil
+}
+
+// refund returns a token taken by wait.
+func (b *tokenBucket) refund() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+type rateLimitKey struct{}
+
+// withRateLimitKey marks ctx so requests made with it use key's bucket.
+func withRateLimitKey(ctx context.Context, key ID) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, rateLimitKey{}, string(key))
+}
+
+func rateLimitKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(rateLimitKey{}).(string)
+	return key
+}
@@ -0,0 +1,240 @@
+package maxbot
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRedisDialTimeout = 2 * time.Second
+	defaultRedisIOTimeout   = 2 * time.Second
+)
+
+// RedisBackendConfig configures NewRedisRateLimitBackend.
+type RedisBackendConfig struct {
+	Addr        string
+	Password    string
+	DialTimeout time.Duration
+	// IOTimeout bounds each round trip when ctx has no earlier deadline.
+	IOTimeout time.Duration
+}
+
+// RedisRateLimitBackend is a RateLimitBackend that keeps fixed-window
+// counters in Redis (or any server speaking RESP with MULTI/EXEC, SET NX PX,
+// INCR, PTTL and PEXPIRE). It uses a single connection and redials after
+// errors.
+type RedisRateLimitBackend struct {
+	cfg RedisBackendConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisRateLimitBackend creates a backend; the connection is opened on
+// first use.
+func NewRedisRateLimitBackend(cfg RedisBackendConfig) *RedisRateLimitBackend {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = defaultRedisDialTimeout
+	}
+	if cfg.IOTimeout <= 0 {
+		cfg.IOTimeout = defaultRedisIOTimeout
+	}
+	return &RedisRateLimitBackend{cfg: cfg}
+}
+
+func (b *RedisRateLimitBackend) Take(ctx context.Context, key string, limit int, window time.Duration) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The transaction keeps the key from expiring between SET and INCR,
+	// which would leave a counter without a TTL.
+	windowMS := strconv.FormatInt(window.Milliseconds(), 10)
+	replies, err := b.roundTrip(ctx,
+		[]string{"MULTI"},
+		[]string{"SET", key, "0", "PX", windowMS, "NX"},
+		[]string{"INCR", key},
+		[]string{"PTTL", key},
+		[]string{"EXEC"},
+	)
+	if err != nil {
+		return 0, err
+	}
+	results, _ := replies[4].([]any)
+	if len(results) != 3 {
+		return 0, fmt.Errorf("redis rate limit: unexpected replies %v", replies)
+	}
+	count, ok1 := results[1].(int64)
+	ttl, ok2 := results[2].(int64)
+	if !ok1 || !ok2 {
+		return 0, fmt.Errorf("redis rate limit: unexpected replies %v", results)
+	}
+	if ttl == -1 {
+		// A counter without expiry (e.g. left by an older client) would
+		// block every replica forever once over the limit.
+		if _, err := b.roundTrip(ctx, []string{"PEXPIRE", key, windowMS}); err != nil {
+			return 0, err
+		}
+		ttl = window.Milliseconds()
+	}
+	if count <= int64(limit) {
+		return 0, nil
+	}
+	if ttl <= 0 {
+		return window, nil
+	}
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+// Close closes the connection.
+func (b *RedisRateLimitBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn, b.rd = nil, nil
+	return err
+}
+
+// roundTrip pipelines cmds and reads one reply per command. Cancelling ctx
+// closes the connection to abort the exchange. Any error drops the
+// connection so the next call redials.
+func (b *RedisRateLimitBackend) roundTrip(ctx context.Context, cmds ...[]string) ([]any, error) {
+	if err := b.connect(ctx); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(b.cfg.IOTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = b.conn.SetDeadline(deadline)
+	conn := b.conn
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	replies, err := b.exchange(cmds)
+	if !stop() && err == nil {
+		// ctx fired after the replies arrived and closed the connection.
+		b.conn, b.rd = nil, nil
+		return replies, nil
+	}
+	if err != nil {
+		b.conn.Close()
+		b.conn, b.rd = nil, nil
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("redis rate limit: %w", err)
+	}
+	return replies, nil
+}
+
+func (b *RedisRateLimitBackend) exchange(cmds [][]string) ([]any, error) {
+	var buf []byte
+	for _, cmd := range cmds {
+		buf = appendRESPCommand(buf, cmd)
+	}
+	if _, err := b.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(cmds))
+	for i := range cmds {
+		reply, err := readRESPReply(b.rd)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+func (b *RedisRateLimitBackend) connect(ctx context.Context) error {
+	if b.conn != nil {
+		return nil
+	}
+	d := net.Dialer{Timeout: b.cfg.DialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", b.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("redis rate limit: %w", err)
+	}
+	b.conn, b.rd = conn, bufio.NewReader(conn)
+	if b.cfg.Password != "" {
+		if _, err := b.roundTrip(ctx, []string{"AUTH", b.cfg.Password}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendRESPCommand(buf []byte, args []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// readRESPReply reads one reply: string, int64, nil, []any, or an error for
+// transport and protocol failures. Server errors are returned as errors too.
+func readRESPReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("malformed resp line")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRESPReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown resp type %q", kind)
+	}
+}
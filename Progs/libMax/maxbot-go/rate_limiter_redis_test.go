@@ -0,0 +1,356 @@
+package maxbot
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRESPServer is a minimal in-memory stand-in for Redis implementing the
+// commands used by RedisRateLimitBackend.
+type fakeRESPServer struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	values  map[string]int64
+	expires map[string]time.Time
+}
+
+func newFakeRESPServer(t *testing.T, password string) *fakeRESPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeRESPServer{ln: ln, password: password, values: map[string]int64{}, expires: map[string]time.Time{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRESPServer) Addr() string { return s.ln.Addr().String() }
+
+func (s *fakeRESPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := s.password == ""
+	var queued [][]string // commands inside MULTI; nil outside a transaction
+	for {
+		reply, err := readRESPReply(rd)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+		var out string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authed = len(args) == 2 && args[1] == s.password
+			out = "+OK\r\n"
+			if !authed {
+				out = "-ERR invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case cmd == "MULTI":
+			queued = [][]string{}
+			out = "+OK\r\n"
+		case cmd == "EXEC":
+			s.mu.Lock()
+			out = fmt.Sprintf("*%d\r\n", len(queued))
+			for _, q := range queued {
+				out += s.exec(strings.ToUpper(q[0]), q[1:])
+			}
+			s.mu.Unlock()
+			queued = nil
+		case queued != nil:
+			queued = append(queued, args)
+			out = "+QUEUED\r\n"
+		default:
+			s.mu.Lock()
+			out = s.exec(cmd, args[1:])
+			s.mu.Unlock()
+		}
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs one command; s.mu must be held.
+func (s *fakeRESPServer) exec(cmd string, args []string) string {
+	now := time.Now()
+	for k, exp := range s.expires {
+		if !now.Before(exp) {
+			delete(s.values, k)
+			delete(s.expires, k)
+		}
+	}
+	switch cmd {
+	case "SET":
+		key := args[0]
+		if _, exists := s.values[key]; exists {
+			return "$-1\r\n"
+		}
+		v, _ := strconv.ParseInt(args[1], 10, 64)
+		s.values[key] = v
+		for i := 2; i+1 < len(args); i++ {
+			if strings.EqualFold(args[i], "PX") {
+				ms, _ := strconv.ParseInt(args[i+1], 10, 64)
+				s.expires[key] = now.Add(time.Duration(ms) * time.Millisecond)
+			}
+		}
+		return "+OK\r\n"
+	case "INCR":
+		s.values[args[0]]++
+		return fmt.Sprintf(":%d\r\n", s.values[args[0]])
+	case "PEXPIRE":
+		if _, ok := s.values[args[0]]; !ok {
+			return ":0\r\n"
+		}
+		ms, _ := strconv.ParseInt(args[1], 10, 64)
+		s.expires[args[0]] = now.Add(time.Duration(ms) * time.Millisecond)
+		return ":1\r\n"
+	case "PTTL":
+		exp, ok := s.expires[args[0]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", exp.Sub(now).Milliseconds())
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func TestRedisBackendTakeCountsWindow(t *testing.T) {
+	srv := newFakeRESPServer(t, "secret")
+	b := NewRedisRateLimitBackend(RedisBackendConfig{Addr: srv.Addr(), Password: "secret"})
+	defer b.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		wait, err := b.Take(ctx, "k", 2, time.Second)
+		if err != nil || wait != 0 {
+			t.Fatalf("take %d: wait=%v err=%v", i, wait, err)
+		}
+	}
+	wait, err := b.Take(ctx, "k", 2, time.Second)
+	if err != nil {
+		t.Fatalf("Take error: %v", err)
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("expected wait within window, got %v", wait)
+	}
+
+	bad := NewRedisRateLimitBackend(RedisBackendConfig{Addr: srv.Addr(), Password: "wrong"})
+	defer bad.Close()
+	if _, err := bad.Take(ctx, "k", 2, time.Second); err == nil {
+		t.Fatal("expected auth error")
+	}
+}
+
+func TestRedisBackendRestoresExpiryOfCounterWithoutTTL(t *testing.T) {
+	srv := newFakeRESPServer(t, "")
+	// A counter over the limit with no expiry: PTTL reports -1.
+	srv.mu.Lock()
+	srv.values["k"] = 5
+	srv.mu.Unlock()
+	b := NewRedisRateLimitBackend(RedisBackendConfig{Addr: srv.Addr()})
+	defer b.Close()
+	ctx := context.Background()
+
+	wait, err := b.Take(ctx, "k", 2, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Take error: %v", err)
+	}
+	if wait <= 0 || wait > 50*time.Millisecond {
+		t.Fatalf("expected to wait out the window, got %v", wait)
+	}
+	srv.mu.Lock()
+	_, hasTTL := srv.expires["k"]
+	srv.mu.Unlock()
+	if !hasTTL {
+		t.Fatal("expected the counter to get an expiry")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if wait, err := b.Take(ctx, "k", 2, 50*time.Millisecond); err != nil || wait != 0 {
+		t.Fatalf("expected the counter to reset after the window, wait=%v err=%v", wait, err)
+	}
+}
+
+func TestRedisBackendTakeStopsOnContextCancel(t *testing.T) {
+	// A server that accepts commands but never replies.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	b := NewRedisRateLimitBackend(RedisBackendConfig{Addr: ln.Addr().String(), IOTimeout: 5 * time.Second})
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := b.Take(ctx, "k", 2, time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Take to return on cancel, took %v", elapsed)
+	}
+}
+
+func TestSharedRateLimiterSharesBudgetAcrossReplicas(t *testing.T) {
+	srv := newFakeRESPServer(t, "")
+	newReplica := func() *SharedRateLimiter {
+		return NewSharedRateLimiter(SharedRateLimitConfig{
+			Backend: NewRedisRateLimitBackend(RedisBackendConfig{Addr: srv.Addr()}),
+			Prefix:  "test",
+			RPS:     3,
+		})
+	}
+	replicas := []*SharedRateLimiter{newReplica(), newReplica()}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(l *SharedRateLimiter) {
+			defer wg.Done()
+			if err := l.Wait(context.Background(), ""); err != nil {
+				t.Errorf("Wait error: %v", err)
+			}
+		}(replicas[i%2])
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Fatalf("expected replicas to share a 3 rps budget, 6 requests took %v", elapsed)
+	}
+}
+
+func TestSharedRateLimiterFallsBackWhenBackendDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	fallback := &recordingLimiter{}
+	l := NewSharedRateLimiter(SharedRateLimitConfig{
+		Backend:  NewRedisRateLimitBackend(RedisBackendConfig{Addr: addr, DialTimeout: 100 * time.Millisecond}),
+		Fallback: fallback,
+	})
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background(), "42"); err != nil {
+			t.Fatalf("Wait error: %v", err)
+		}
+	}
+	if len(fallback.keys) != 3 || fallback.keys[0] != "42" {
+		t.Fatalf("expected fallback to be used, got %v", fallback.keys)
+	}
+}
+
+// flakyGlobalBackend charges chat keys and fails on the global key.
+type flakyGlobalBackend struct {
+	mu    sync.Mutex
+	taken []string
+}
+
+func (b *flakyGlobalBackend) Take(_ context.Context, key string, _ int, _ time.Duration) (time.Duration, error) {
+	if strings.HasSuffix(key, ":global") {
+		return 0, fmt.Errorf("backend unavailable")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.taken = append(b.taken, key)
+	return 0, nil
+}
+
+func TestSharedRateLimiterFallbackChargesOnlyRemainder(t *testing.T) {
+	backend := &flakyGlobalBackend{}
+	fallback := &recordingLimiter{}
+	l := NewSharedRateLimiter(SharedRateLimitConfig{Backend: backend, ChatRPS: 1, Fallback: fallback})
+	if err := l.Wait(context.Background(), "42"); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	if len(backend.taken) != 1 || backend.taken[0] != "maxbot:ratelimit:chat:42" {
+		t.Fatalf("expected the chat token to be taken from the backend, got %v", backend.taken)
+	}
+	if len(fallback.keys) != 1 || fallback.keys[0] != "" {
+		t.Fatalf("expected the fallback to charge only the global token, got %v", fallback.keys)
+	}
+}
+
+// recordingBackend admits every request and records the keys it charged.
+type recordingBackend struct {
+	mu    sync.Mutex
+	taken []string
+}
+
+func (b *recordingBackend) Take(_ context.Context, key string, _ int, _ time.Duration) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.taken = append(b.taken, key)
+	return 0, nil
+}
+
+func TestSharedRateLimiterChatBudgetIsOptIn(t *testing.T) {
+	backend := &recordingBackend{}
+	l := NewSharedRateLimiter(SharedRateLimitConfig{Backend: backend})
+	if err := l.Wait(context.Background(), "42"); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	if len(backend.taken) != 1 || backend.taken[0] != "maxbot:ratelimit:global" {
+		t.Fatalf("expected only the global budget to be charged by default, got %v", backend.taken)
+	}
+}
+
+func TestSharedRateLimiterDefaultFallbackIsConservative(t *testing.T) {
+	l := NewSharedRateLimiter(SharedRateLimitConfig{RPS: 40})
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_ = l.Wait(ctx, "")
+	}
+	// 40 rps shared by default fallback share of 4 -> 10 rps locally.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected local fallback pacing, took %v", elapsed)
+	}
+}
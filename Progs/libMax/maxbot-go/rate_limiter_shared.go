@@ -0,0 +1,130 @@
+package maxbot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSharedRateLimitPrefix = "maxbot:ratelimit"
+	defaultSharedFallbackShare   = 4
+	sharedBackendRetryAfter      = time.Second
+)
+
+// RateLimitBackend stores request counters shared by several processes.
+type RateLimitBackend interface {
+	// Take counts one request against key, which admits limit requests per
+	// window. It returns zero when the request may proceed, or how long to
+	// wait before trying again.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (time.Duration, error)
+}
+
+// SharedRateLimitConfig configures NewSharedRateLimiter.
+type SharedRateLimitConfig struct {
+	Backend RateLimitBackend
+	// Prefix namespaces backend keys; use one per bot token.
+	Prefix string
+	// RPS is the budget shared by all replicas (default 30). ChatRPS is the
+	// shared per-chat budget for message sends; like RateLimitConfig.ChatRPS
+	// it is off unless positive.
+	RPS     int
+	ChatRPS int
+	// Fallback is used while the backend is unreachable. By default it is a
+	// local token bucket allowing a quarter of RPS and ChatRPS.
+	Fallback RateLimiter
+}
+
+// SharedRateLimiter is a RateLimiter whose budget is shared between
+// replicas through a RateLimitBackend. When the backend fails it degrades
+// to a conservative local limiter and retries the backend after a second.
+type SharedRateLimiter struct {
+	backend  RateLimitBackend
+	prefix   string
+	rps      int
+	chatRPS  int
+	fallback RateLimiter
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// NewSharedRateLimiter creates a SharedRateLimiter.
+func NewSharedRateLimiter(cfg SharedRateLimitConfig) *SharedRateLimiter {
+	l := &SharedRateLimiter{
+		backend:  cfg.Backend,
+		prefix:   cfg.Prefix,
+		rps:      cfg.RPS,
+		chatRPS:  cfg.ChatRPS,
+		fallback: cfg.Fallback,
+	}
+	if l.prefix == "" {
+		l.prefix = defaultSharedRateLimitPrefix
+	}
+	if l.rps <= 0 {
+		l.rps = defaultRateLimitRPS
+	}
+	if l.fallback == nil {
+		l.fallback = newTokenBucketLimiter(
+			float64(l.rps)/defaultSharedFallbackShare, 1,
+			float64(l.chatRPS)/defaultSharedFallbackShare, 1,
+		)
+	}
+	return l
+}
+
+func (l *SharedRateLimiter) Wait(ctx context.Context, key string) error {
+	if l.backend == nil || l.backendDown() {
+		return l.fallback.Wait(ctx, key)
+	}
+	if key != "" && l.chatRPS > 0 {
+		if err := l.take(ctx, l.prefix+":chat:"+key, l.chatRPS); err != nil {
+			return l.degrade(ctx, key, err)
+		}
+	}
+	if err := l.take(ctx, l.prefix+":global", l.rps); err != nil {
+		// The backend already charged the chat budget, so only the global
+		// token is left for the fallback.
+		if l.chatRPS > 0 {
+			key = ""
+		}
+		return l.degrade(ctx, key, err)
+	}
+	return nil
+}
+
+// RPS returns the budget shared by all replicas.
+func (l *SharedRateLimiter) RPS() float64 {
+	return float64(l.rps)
+}
+
+func (l *SharedRateLimiter) take(ctx context.Context, key string, limit int) error {
+	for {
+		wait, err := l.backend.Take(ctx, key, limit, time.Second)
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if err := sleepWithContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *SharedRateLimiter) degrade(ctx context.Context, key string, err error) error {
+	if isContextError(err) {
+		return err
+	}
+	l.mu.Lock()
+	l.downUntil = time.Now().Add(sharedBackendRetryAfter)
+	l.mu.Unlock()
+	return l.fallback.Wait(ctx, key)
+}
+
+func (l *SharedRateLimiter) backendDown() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.downUntil)
+}
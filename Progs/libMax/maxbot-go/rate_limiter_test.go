@@ -0,0 +1,177 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllowsBurstThenPaces(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{RPS: 20, Burst: 5})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.Wait(ctx, ""); err != nil {
+			t.Fatalf("Wait error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("burst should not wait, took %v", elapsed)
+	}
+
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, ""); err != nil {
+			t.Fatalf("Wait error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected pacing after burst, took %v", elapsed)
+	}
+}
+
+func TestTokenBucketWaitersSleepConcurrently(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{RPS: 10, Burst: 1})
+	ctx := context.Background()
+	_ = l.Wait(ctx, "")
+
+	// A waiter whose context expires must not hold up the others.
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(short, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = l.Wait(ctx, "")
+		}()
+	}
+	wg.Wait()
+	// Three tokens at 10 rps take ~300ms; the cancelled reservation was
+	// returned, so nothing beyond that is added.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 450*time.Millisecond {
+		t.Fatalf("unexpected total wait %v", elapsed)
+	}
+}
+
+func TestTokenBucketPerChatBuckets(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{RPS: -1, ChatRPS: 5, ChatBurst: 1})
+	ctx := context.Background()
+
+	start := time.Now()
+	_ = l.Wait(ctx, "chat-a")
+	_ = l.Wait(ctx, "chat-b")
+	_ = l.Wait(ctx, "")
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("different chats should not wait on each other, took %v", elapsed)
+	}
+	_ = l.Wait(ctx, "chat-a")
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected second send to chat-a to wait, took %v", elapsed)
+	}
+}
+
+func TestTokenBucketAcceptsFractionalRates(t *testing.T) {
+	// 20 messages a minute is a third of a token per second.
+	l := NewRateLimiter(RateLimitConfig{RPS: -1, ChatRPS: 20.0 / 60, ChatBurst: 1})
+	ctx := context.Background()
+	if err := l.Wait(ctx, "group"); err != nil {
+		t.Fatalf("first wait error: %v", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(short, "group"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the second send to wait ~3s, got %v", err)
+	}
+	if rps := NewRateLimiter(RateLimitConfig{RPS: 0.5}).RPS(); rps != 0.5 {
+		t.Fatalf("expected global rate 0.5, got %v", rps)
+	}
+}
+
+func TestTokenBucketPerChatLimitIsOptIn(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{RPS: -1})
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		_ = l.Wait(ctx, "chat-a")
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("expected no per-chat limit by default, took %v", elapsed)
+	}
+}
+
+func TestTokenBucketRefundsChatTokenWhenGlobalWaitIsCancelled(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{RPS: 1, Burst: 1, ChatRPS: 1, ChatBurst: 1})
+	ctx := context.Background()
+	_ = l.Wait(ctx, "")
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(short, "chat-a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	l.mu.Lock()
+	chat := l.chats["chat-a"]
+	l.mu.Unlock()
+	chat.mu.Lock()
+	tokens := chat.tokens
+	chat.mu.Unlock()
+	if tokens < 0.99 {
+		t.Fatalf("expected the chat token to be refunded, have %v", tokens)
+	}
+}
+
+type recordingLimiter struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *recordingLimiter) Wait(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func TestClientUsesCustomRateLimiterWithChatKeys(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"updates":[]}`))
+	}))
+	defer ts.Close()
+
+	limiter := &recordingLimiter{}
+	c, err := NewClient(ClientConfig{Token: "test-token", BaseURL: ts.URL, RateLimiter: limiter})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := c.GetUpdates(ctx, GetUpdatesOptions{}); err != nil {
+		t.Fatalf("GetUpdates error: %v", err)
+	}
+	if err := c.SendMessage(ctx, SendMessageRequest{ChatID: "42", Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+	if err := c.SendMedia(ctx, SendMediaRequest{ChatID: "7", MediaID: "m"}); err != nil {
+		t.Fatalf("SendMedia error: %v", err)
+	}
+
+	want := []string{"", "42", "7"}
+	if len(limiter.keys) != len(want) {
+		t.Fatalf("expected keys %v, got %v", want, limiter.keys)
+	}
+	for i := range want {
+		if limiter.keys[i] != want[i] {
+			t.Fatalf("expected keys %v, got %v", want, limiter.keys)
+		}
+	}
+}
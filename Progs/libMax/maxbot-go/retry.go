@@ -0,0 +1,93 @@
+package maxbot
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IdempotencyKeyHeader carries the idempotency key of a request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryRequest describes a failed attempt offered to a RetryPolicy.
+type RetryRequest struct {
+	Method string
+	Path   string
+	// Attempt is the zero-based number of the attempt that failed.
+	Attempt int
+	// IdempotencyKey is the caller-supplied key, if any. Keys generated
+	// for sends are not reported since the API may not deduplicate them.
+	IdempotencyKey string
+}
+
+// Idempotent reports whether repeating the request cannot duplicate its
+// effect: every method but POST, and POSTs with an idempotency key.
+func (r RetryRequest) Idempotent() bool {
+	return r.Method != http.MethodPost || r.IdempotencyKey != ""
+}
+
+// RetryPolicy decides whether and when a failed attempt is retried. err is
+// an *APIError for HTTP error responses and the transport error otherwise;
+// context errors are never offered.
+type RetryPolicy interface {
+	Retry(req RetryRequest, err error) (delay time.Duration, retry bool)
+}
+
+// DefaultRetryPolicy retries up to MaxRetries times with full-jitter
+// exponential backoff, honouring Retry-After. Non-idempotent requests are
+// only retried when they cannot have been processed: connection errors and
+// 429 responses.
+type DefaultRetryPolicy struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (p DefaultRetryPolicy) Retry(req RetryRequest, err error) (time.Duration, bool) {
+	if req.Attempt >= p.MaxRetries {
+		return 0, false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if !apiErr.Temporary() {
+			return 0, false
+		}
+		if !errors.Is(apiErr, ErrRateLimited) && !req.Idempotent() {
+			return 0, false
+		}
+		if apiErr.RetryAfter > 0 {
+			return apiErr.RetryAfter, true
+		}
+		return p.Backoff(req.Attempt), true
+	}
+	if !req.Idempotent() && !isConnectionError(err) {
+		return 0, false
+	}
+	return p.Backoff(req.Attempt), true
+}
+
+// Backoff returns a random delay in [0, min(MaxBackoff, InitialBackoff*2^attempt)].
+func (p DefaultRetryPolicy) Backoff(attempt int) time.Duration {
+	ceiling := float64(p.InitialBackoff) * math.Pow(2, float64(attempt))
+	if p.MaxBackoff > 0 && ceiling > float64(p.MaxBackoff) {
+		ceiling = float64(p.MaxBackoff)
+	}
+	if ceiling < 1 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// isConnectionError reports whether err happened before the request could
+// reach the server.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
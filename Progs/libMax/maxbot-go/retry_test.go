@@ -0,0 +1,178 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newStatusSequenceServer(t *testing.T, statuses ...int) (*httptest.Server, *int32, *[]string) {
+	t.Helper()
+	var calls int32
+	var mu sync.Mutex
+	var keys []string
+	ts := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		mu.Lock()
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		mu.Unlock()
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			_, _ = w.Write([]byte(`{"message":"fail"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true}`))
+	})
+	return ts, &calls, &keys
+}
+
+func newRetryTestClient(t *testing.T, baseURL string, hc *http.Client) *Client {
+	t.Helper()
+	return newTestClient(t, baseURL, ClientConfig{
+		HTTPClient:                hc,
+		MaxRetries:                2,
+		InitialBackoff:            time.Millisecond,
+		MaxBackoff:                2 * time.Millisecond,
+		DisableAdaptiveThrottling: true,
+	})
+}
+
+func TestSendMessageNotRetriedOn5xxWithoutIdempotencyKey(t *testing.T) {
+	ts, calls, _ := newStatusSequenceServer(t, http.StatusBadGateway)
+	c := newRetryTestClient(t, ts.URL, nil)
+
+	err := c.SendMessage(context.Background(), SendMessageRequest{ChatID: "1", Text: "hi"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 error, got %v", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Fatalf("expected a single attempt, got %d", got)
+	}
+}
+
+func TestSendMessageRetriedWithIdempotencyKey(t *testing.T) {
+	ts, calls, keys := newStatusSequenceServer(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	c := newRetryTestClient(t, ts.URL, nil)
+
+	ctx := WithIdempotencyKey(context.Background(), "send-1")
+	if err := c.SendMessage(ctx, SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+	for _, k := range *keys {
+		if k != "send-1" {
+			t.Fatalf("expected constant idempotency key, got %v", *keys)
+		}
+	}
+}
+
+func TestSendMessageRetriedOn429(t *testing.T) {
+	ts, calls, _ := newStatusSequenceServer(t, http.StatusTooManyRequests)
+	c := newRetryTestClient(t, ts.URL, nil)
+
+	if err := c.SendMessage(context.Background(), SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Fatalf("expected 2 attempts, got %d", got)
+	}
+}
+
+func TestSendMessageRetriesOnlyConnectionErrors(t *testing.T) {
+	var calls int32
+	var failure error
+	hc := &http.Client{Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, failure
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+	})}
+	c := newRetryTestClient(t, "https://example.test", hc)
+
+	failure = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	if err := c.SendMessage(context.Background(), SendMessageRequest{ChatID: "1", Text: "hi"}); err != nil {
+		t.Fatalf("expected dial error to be retried, got %v", err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	failure = &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+	if err := c.SendMessage(context.Background(), SendMessageRequest{ChatID: "1", Text: "hi"}); err == nil {
+		t.Fatal("expected read error after sending not to be retried")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected a single attempt, got %d", got)
+	}
+}
+
+type recordingRetryPolicy struct {
+	requests []RetryRequest
+}
+
+func (p *recordingRetryPolicy) Retry(req RetryRequest, err error) (time.Duration, bool) {
+	p.requests = append(p.requests, req)
+	return 0, req.Attempt < 1
+}
+
+func TestCustomRetryPolicy(t *testing.T) {
+	ts, calls, _ := newStatusSequenceServer(t, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest)
+	policy := &recordingRetryPolicy{}
+	c, err := NewClient(ClientConfig{Token: "test-token", BaseURL: ts.URL, RateLimitRPS: -1, RetryPolicy: policy})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+
+	if _, err := c.GetUpdates(context.Background(), GetUpdatesOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Fatalf("expected policy to allow one retry, got %d attempts", got)
+	}
+	if len(policy.requests) != 2 || policy.requests[0].Method != http.MethodGet || policy.requests[0].Path != "/updates" || policy.requests[1].Attempt != 1 {
+		t.Fatalf("unexpected retry requests: %+v", policy.requests)
+	}
+}
+
+func TestDefaultRetryPolicyFullJitter(t *testing.T) {
+	p := DefaultRetryPolicy{MaxRetries: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	distinct := map[time.Duration]bool{}
+	for i := 0; i < 50; i++ {
+		d := p.Backoff(5)
+		if d < 0 || d > time.Second {
+			t.Fatalf("backoff %v out of range", d)
+		}
+		distinct[d] = true
+	}
+	if len(distinct) < 10 {
+		t.Fatalf("expected jittered delays, got %d distinct values", len(distinct))
+	}
+	if d := p.Backoff(0); d > 100*time.Millisecond {
+		t.Fatalf("first backoff %v exceeds initial backoff", d)
+	}
+}
+
+func TestParseRetryAfterHTTPDate(t *testing.T) {
+	at := time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(at); d < 3*time.Second || d > 5*time.Second {
+		t.Fatalf("expected ~5s from HTTP date, got %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)); d != 0 {
+		t.Fatalf("expected 0 for past date, got %v", d)
+	}
+	if d := parseRetryAfter("2"); d != 2*time.Second {
+		t.Fatalf("expected 2s, got %v", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Fatalf("expected 0 for invalid value, got %v", d)
+	}
+}
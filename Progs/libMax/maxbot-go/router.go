@@ -3,6 +3,7 @@ package maxbot
 import (
 	"context"
 	"strings"
+	"time"
 )
 
 type Handler func(*Context) error
@@ -12,7 +13,14 @@ type Router struct {
 	commands    map[string]Handler
 	onText      Handler
 	onCallback  Handler
+	callbacks   []callbackRoute
 	middlewares []Middleware
+	timeout     time.Duration
+}
+
+type callbackRoute struct {
+	prefix  string
+	handler Handler
 }
 
 func NewRouter() *Router {
@@ -41,25 +49,50 @@ func (r *Router) HandleCallback(handler Handler) {
 	r.onCallback = handler
 }
 
+// HandleCallbackPrefix routes callbacks whose data equals prefix or starts
+// with prefix followed by ':'. Prefix routes are tried in registration order
+// before the HandleCallback fallback.
+func (r *Router) HandleCallbackPrefix(prefix string, handler Handler) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || handler == nil {
+		return
+	}
+	r.callbacks = append(r.callbacks, callbackRoute{prefix: prefix, handler: handler})
+}
+
 func (r *Router) Dispatch(ctx context.Context, client *Client, upd Update) error {
+	h := r.route(upd)
+	if h == nil {
+		return nil
+	}
 	c := &Context{
 		ctx:    ctx,
 		Client: client,
 		Update: upd,
 	}
+	h = chain(r.middlewares, h)
+	if r.timeout > 0 {
+		return runWithTimeout(c, r.timeout, h)
+	}
+	return h(c)
+}
+
+func (r *Router) route(upd Update) Handler {
 	if upd.Message != nil {
 		if cmd := upd.Message.Command(); cmd != "" {
 			if h, ok := r.commands[cmd]; ok {
-				return chain(r.middlewares, h)(c)
+				return h
 			}
 		}
-		if r.onText != nil {
-			return chain(r.middlewares, r.onText)(c)
-		}
-		return nil
+		return r.onText
 	}
-	if upd.Callback != nil && r.onCallback != nil {
-		return chain(r.middlewares, r.onCallback)(c)
+	if upd.Callback != nil {
+		for _, route := range r.callbacks {
+			if matchCallbackPrefix(upd.Callback.Data, route.prefix) {
+				return route.handler
+			}
+		}
+		return r.onCallback
 	}
 	return nil
 }
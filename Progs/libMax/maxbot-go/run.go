@@ -0,0 +1,159 @@
+package maxbot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RunMode selects the runtime used by Bot.Run.
+type RunMode string
+
+const (
+	RunPolling RunMode = "polling"
+	RunWebhook RunMode = "webhook"
+)
+
+// RunConfig configures Bot.Run.
+type RunConfig struct {
+	// Mode defaults to RunPolling.
+	Mode RunMode
+	// Webhook is used in RunWebhook mode.
+	Webhook WebhookOptions
+	// ShutdownTimeout overrides WithShutdownGrace in both modes.
+	// Webhook.ShutdownTimeout takes precedence in RunWebhook mode.
+	ShutdownTimeout time.Duration
+	// Signals trigger a graceful Shutdown; SIGINT and SIGTERM by default.
+	// A second signal is left to the default handler and kills the process.
+	Signals []os.Signal
+	// DisableSignals leaves signal handling to the caller.
+	DisableSignals bool
+}
+
+// RunConfigFromEnv builds a RunConfig from environment variables:
+//
+//	MAX_MODE                 polling (default) or webhook
+//	MAX_WEBHOOK_ADDR         listen address, e.g. :8080
+//	MAX_WEBHOOK_PATH         endpoint path, e.g. /webhook
+//	MAX_WEBHOOK_URL          public URL registered as a subscription
+//	MAX_WEBHOOK_SECRET       X-Max-Bot-Api-Secret value
+//	MAX_WEBHOOK_TLS_CERT     certificate file
+//	MAX_WEBHOOK_TLS_KEY      key file
+//	MAX_WEBHOOK_BACKGROUND   true to acknowledge before handling
+//	MAX_WEBHOOK_UNSUBSCRIBE  true to remove the subscription on shutdown
+//	MAX_SHUTDOWN_TIMEOUT     shutdown grace in both modes, e.g. 10s
+func RunConfigFromEnv() (RunConfig, error) {
+	cfg := RunConfig{
+		Mode: RunMode(strings.ToLower(strings.TrimSpace(os.Getenv("MAX_MODE")))),
+		Webhook: WebhookOptions{
+			Addr:        os.Getenv("MAX_WEBHOOK_ADDR"),
+			Path:        os.Getenv("MAX_WEBHOOK_PATH"),
+			PublicURL:   os.Getenv("MAX_WEBHOOK_URL"),
+			Secret:      os.Getenv("MAX_WEBHOOK_SECRET"),
+			TLSCertFile: os.Getenv("MAX_WEBHOOK_TLS_CERT"),
+			TLSKeyFile:  os.Getenv("MAX_WEBHOOK_TLS_KEY"),
+		},
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = RunPolling
+	}
+	if err := cfg.validate(); err != nil {
+		return RunConfig{}, err
+	}
+
+	var err error
+	if cfg.Webhook.HandleInBackground, err = envBool("MAX_WEBHOOK_BACKGROUND"); err != nil {
+		return RunConfig{}, err
+	}
+	if cfg.Webhook.UnsubscribeOnShutdown, err = envBool("MAX_WEBHOOK_UNSUBSCRIBE"); err != nil {
+		return RunConfig{}, err
+	}
+	if v := os.Getenv("MAX_SHUTDOWN_TIMEOUT"); v != "" {
+		if cfg.ShutdownTimeout, err = time.ParseDuration(v); err != nil {
+			return RunConfig{}, fmt.Errorf("MAX_SHUTDOWN_TIMEOUT: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+func envBool(name string) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+func (cfg RunConfig) validate() error {
+	switch cfg.Mode {
+	case "", RunPolling, RunWebhook:
+		return nil
+	default:
+		return fmt.Errorf("unknown run mode %q", cfg.Mode)
+	}
+}
+
+// Run starts the runtime selected by cfg and blocks until it stops. Signals
+// listed in cfg trigger Shutdown, after which Run returns nil. Lifecycle
+// hooks run in both modes.
+func (b *Bot) Run(ctx context.Context, cfg RunConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	grace := b.shutdownGrace
+	if cfg.ShutdownTimeout > 0 {
+		grace = cfg.ShutdownTimeout
+	}
+	if cfg.Mode == RunWebhook && cfg.Webhook.ShutdownTimeout > 0 {
+		grace = cfg.Webhook.ShutdownTimeout
+	}
+
+	if !cfg.DisableSignals {
+		signals := cfg.Signals
+		if len(signals) == 0 {
+			signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+		}
+		stop := b.shutdownOnSignal(signals, grace)
+		defer stop()
+	}
+
+	if cfg.Mode == RunWebhook {
+		opts := cfg.Webhook
+		opts.ShutdownTimeout = grace
+		return b.StartWebhook(ctx, opts)
+	}
+	return b.startLongPolling(ctx, grace)
+}
+
+func (b *Bot) shutdownOnSignal(signals []os.Signal, grace time.Duration) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			signal.Stop(ch)
+			b.logger.Infof("received %v, shutting down", sig)
+			ctx, cancel := context.WithTimeout(context.Background(), grace)
+			defer cancel()
+			if err := b.Shutdown(ctx); err != nil {
+				b.logger.Errorf("shutdown aborted in-flight updates: %v", err)
+			}
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
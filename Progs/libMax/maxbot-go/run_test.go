@@ -0,0 +1,136 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunConfigFromEnv(t *testing.T) {
+	t.Setenv("MAX_MODE", "Webhook")
+	t.Setenv("MAX_WEBHOOK_ADDR", ":9000")
+	t.Setenv("MAX_WEBHOOK_PATH", "/hook")
+	t.Setenv("MAX_WEBHOOK_URL", "https://bot.example.com/hook")
+	t.Setenv("MAX_WEBHOOK_SECRET", "s3cret")
+	t.Setenv("MAX_WEBHOOK_BACKGROUND", "true")
+	t.Setenv("MAX_SHUTDOWN_TIMEOUT", "15s")
+
+	cfg, err := RunConfigFromEnv()
+	if err != nil {
+		t.Fatalf("RunConfigFromEnv error: %v", err)
+	}
+	w := cfg.Webhook
+	if cfg.Mode != RunWebhook || w.Addr != ":9000" || w.Path != "/hook" || w.PublicURL != "https://bot.example.com/hook" ||
+		w.Secret != "s3cret" || !w.HandleInBackground || w.UnsubscribeOnShutdown || cfg.ShutdownTimeout != 15*time.Second {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestRunConfigFromEnvDefaultsAndErrors(t *testing.T) {
+	t.Setenv("MAX_MODE", "")
+	cfg, err := RunConfigFromEnv()
+	if err != nil || cfg.Mode != RunPolling {
+		t.Fatalf("expected polling default, got %+v, %v", cfg, err)
+	}
+
+	t.Setenv("MAX_MODE", "carrier-pigeon")
+	if _, err := RunConfigFromEnv(); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+	t.Setenv("MAX_MODE", "polling")
+	t.Setenv("MAX_WEBHOOK_BACKGROUND", "maybe")
+	if _, err := RunConfigFromEnv(); err == nil {
+		t.Fatal("expected error for invalid bool")
+	}
+}
+
+func TestRunPollingUsesShutdownTimeoutFromEnv(t *testing.T) {
+	t.Setenv("MAX_MODE", "polling")
+	t.Setenv("MAX_SHUTDOWN_TIMEOUT", "2s")
+	cfg, err := RunConfigFromEnv()
+	if err != nil {
+		t.Fatalf("RunConfigFromEnv error: %v", err)
+	}
+	if cfg.Mode != RunPolling || cfg.ShutdownTimeout != 2*time.Second {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	cfg.DisableSignals = true
+
+	c := newPollingTestClient(t, `{"updates":[{"update_id":1,"message":{"text":"slow"}}]}`)
+	b := NewBot(c, WithShutdownGrace(time.Millisecond))
+	started := make(chan struct{})
+	var completed atomic.Bool
+	b.HandleText(func(ctx *Context) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		completed.Store(ctx.Context().Err() == nil)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx, cfg) }()
+	<-started
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if !completed.Load() {
+		t.Fatal("expected MAX_SHUTDOWN_TIMEOUT to give the handler time to finish")
+	}
+}
+
+func TestRunPollingStopsOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending os.Interrupt to self is not supported on windows")
+	}
+	c := newPollingTestClient(t, `{"updates":[]}`)
+	b := NewBot(c)
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	b.OnStartup(func(context.Context) error { close(started); return nil })
+	b.OnShutdown(func(context.Context) error { close(stopped); return nil })
+
+	done := make(chan error, 1)
+	go func() { done <- b.Run(context.Background(), RunConfig{Signals: []os.Signal{os.Interrupt}}) }()
+	<-started
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("FindProcess error: %v", err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatalf("Signal error: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run error: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run did not stop on signal")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("expected shutdown hook to run")
+	}
+}
+
+func TestRunWebhookMode(t *testing.T) {
+	b := NewBot(&Client{})
+	boom := errors.New("boom")
+	b.OnStartup(func(context.Context) error { return boom })
+	err := b.Run(context.Background(), RunConfig{Mode: RunWebhook, Webhook: WebhookOptions{Addr: "127.0.0.1:0"}, DisableSignals: true})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected startup hook error from webhook runtime, got %v", err)
+	}
+	if err := b.Run(context.Background(), RunConfig{Mode: "smoke-signals"}); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
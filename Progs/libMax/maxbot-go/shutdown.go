@@ -0,0 +1,187 @@
+package maxbot
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultShutdownGrace = 5 * time.Second
+
+// ShutdownStats counts updates handled during a graceful shutdown.
+type ShutdownStats struct {
+	// Drained updates finished within the grace period.
+	Drained int64
+	// Aborted updates had their context cancelled or were never started
+	// because the grace period expired.
+	Aborted int64
+}
+
+// shutdownState coordinates the two shutdown phases shared by all runtimes:
+// stop (runtimes stop fetching and accepting updates) and abort (handler
+// contexts are cancelled once the grace period is over).
+type shutdownState struct {
+	stopCtx  context.Context
+	stop     context.CancelFunc
+	abortCtx context.Context
+	abort    context.CancelFunc
+
+	once   sync.Once
+	done   chan struct{}
+	err    error
+	active activeCounter
+
+	drained atomic.Int64
+	aborted atomic.Int64
+}
+
+func newShutdownState() *shutdownState {
+	s := &shutdownState{done: make(chan struct{})}
+	s.stopCtx, s.stop = context.WithCancel(context.Background())
+	s.abortCtx, s.abort = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *shutdownState) stopping() bool {
+	return s.stopCtx.Err() != nil
+}
+
+// currentShutdown returns the shutdown state of the current run.
+func (b *Bot) currentShutdown() *shutdownState {
+	b.shutdownMu.Lock()
+	defer b.shutdownMu.Unlock()
+	return b.shutdown
+}
+
+// beginRun returns the shutdown state for a runtime that is starting,
+// replacing it with a fresh one if the previous run was stopped.
+func (b *Bot) beginRun() *shutdownState {
+	b.shutdownMu.Lock()
+	defer b.shutdownMu.Unlock()
+	if b.shutdown.stopping() {
+		b.shutdown = newShutdownState()
+	}
+	return b.shutdown
+}
+
+// WithShutdownGrace sets how long running handlers may finish after the
+// runtime context is cancelled (default 5s). WebhookOptions.ShutdownTimeout
+// overrides it for StartWebhook.
+func WithShutdownGrace(d time.Duration) BotOption {
+	return func(b *Bot) {
+		if d > 0 {
+			b.shutdownGrace = d
+		}
+	}
+}
+
+// Shutdown stops the runtimes from fetching or accepting updates, waits for
+// in-flight handlers and queued background updates until ctx is done, then
+// cancels the remaining handlers' contexts. It returns ctx.Err() if any
+// update was aborted. Shutdown is safe to call from signal handlers and more
+// than once. Starting a runtime again afterwards begins a new run.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	s := b.currentShutdown()
+	s.stop()
+	s.once.Do(func() {
+		go func() {
+			defer close(s.done)
+			b.logger.Infof("bot shutdown started")
+			drainErr := b.DrainWebhook(ctx)
+			waitErr := s.active.wait(ctx)
+			if drainErr != nil || waitErr != nil {
+				s.abort()
+				s.active.wait(context.Background())
+				s.err = ctx.Err()
+			}
+			s.abort()
+			stats := b.ShutdownStats()
+			b.logger.Infof("bot shutdown finished: drained=%d aborted=%d", stats.Drained, stats.Aborted)
+		}()
+	})
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShutdownStats reports how many updates were drained or aborted by the
+// latest Shutdown.
+func (b *Bot) ShutdownStats() ShutdownStats {
+	s := b.currentShutdown()
+	return ShutdownStats{
+		Drained: s.drained.Load(),
+		Aborted: s.aborted.Load(),
+	}
+}
+
+// dispatch runs the router for one update, tracking it for Shutdown. The
+// handler context keeps ctx's values and cancellation and is additionally
+// cancelled when the shutdown grace period expires.
+func (b *Bot) dispatch(ctx context.Context, upd Update) error {
+	s := b.currentShutdown()
+	s.active.add()
+	defer s.active.done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.abortCtx, cancel)
+	defer stop()
+
+	err := b.router.Dispatch(ctx, b.client, upd)
+	if s.stopping() {
+		if s.abortCtx.Err() != nil {
+			s.aborted.Add(1)
+		} else {
+			s.drained.Add(1)
+		}
+	}
+	return err
+}
+
+// activeCounter tracks running handlers and runtime loops.
+type activeCounter struct {
+	mu      sync.Mutex
+	n       int
+	changed chan struct{}
+}
+
+func (a *activeCounter) add() {
+	a.mu.Lock()
+	a.n++
+	a.mu.Unlock()
+}
+
+func (a *activeCounter) done() {
+	a.mu.Lock()
+	a.n--
+	if a.changed != nil {
+		close(a.changed)
+		a.changed = nil
+	}
+	a.mu.Unlock()
+}
+
+func (a *activeCounter) wait(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+		if a.n <= 0 {
+			a.mu.Unlock()
+			return nil
+		}
+		if a.changed == nil {
+			a.changed = make(chan struct{})
+		}
+		ch := a.changed
+		a.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
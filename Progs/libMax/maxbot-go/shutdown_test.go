@@ -0,0 +1,225 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newPollingTestClient(t *testing.T, updates string) *Client {
+	t.Helper()
+	var served atomic.Bool
+	return newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/updates" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if served.CompareAndSwap(false, true) {
+			_, _ = w.Write([]byte(updates))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+		_, _ = w.Write([]byte(`{"updates":[]}`))
+	}, ClientConfig{})
+}
+
+func TestShutdownDrainsInFlightPollingHandler(t *testing.T) {
+	c := newPollingTestClient(t, `{"updates":[{"update_id":1,"message":{"text":"slow"}}]}`)
+	b := NewBot(c)
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	b.HandleText(func(ctx *Context) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		if ctx.Context().Err() != nil {
+			t.Error("handler context cancelled before grace period expired")
+		}
+		close(finished)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- b.StartLongPolling(context.Background()) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := b.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Fatal("expected Shutdown to wait for the running handler")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("StartLongPolling error: %v", err)
+	}
+	if got := b.ShutdownStats(); got.Drained != 1 || got.Aborted != 0 {
+		t.Fatalf("unexpected stats: %+v", got)
+	}
+}
+
+func TestShutdownAbortsHandlersAfterGrace(t *testing.T) {
+	c := newPollingTestClient(t, `{"updates":[{"update_id":1,"message":{"text":"a"}},{"update_id":2,"message":{"text":"b"}}]}`)
+	b := NewBot(c)
+	started := make(chan struct{}, 2)
+	b.HandleText(func(ctx *Context) error {
+		started <- struct{}{}
+		<-ctx.Context().Done()
+		return ctx.Context().Err()
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- b.StartLongPolling(context.Background()) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("StartLongPolling error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StartLongPolling did not return after abort")
+	}
+	if got := b.ShutdownStats(); got.Drained != 0 || got.Aborted != 2 {
+		t.Fatalf("expected the running and the skipped update to be aborted, got %+v", got)
+	}
+	if len(started) != 0 {
+		t.Fatal("expected remaining batch to be skipped after abort")
+	}
+}
+
+func TestLongPollingContextCancelUsesGrace(t *testing.T) {
+	c := newPollingTestClient(t, `{"updates":[{"update_id":1,"message":{"text":"slow"}}]}`)
+	b := NewBot(c, WithShutdownGrace(2*time.Second))
+	started := make(chan struct{})
+	var completed atomic.Bool
+	b.HandleText(func(ctx *Context) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		completed.Store(ctx.Context().Err() == nil)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.StartLongPolling(ctx) }()
+	<-started
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if !completed.Load() {
+		t.Fatal("expected handler to finish with a live context")
+	}
+	if got := b.ShutdownStats(); got.Drained != 1 {
+		t.Fatalf("unexpected stats: %+v", got)
+	}
+}
+
+func TestWebhookRejectsUpdatesWhileShuttingDown(t *testing.T) {
+	b := NewBot(&Client{})
+	b.HandleText(func(c *Context) error { return nil })
+	h, err := b.WebhookHandler(WebhookOptions{})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":1,"message":{"text":"hi"}}`))
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+}
+
+func TestBotRestartsAfterShutdown(t *testing.T) {
+	var polls atomic.Int32
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		polls.Add(1)
+		_, _ = w.Write([]byte(`{"updates":[]}`))
+	}, ClientConfig{})
+	b := NewBot(c, WithPolling(PollingOptions{IdleDelay: time.Millisecond}))
+	b.HandleText(func(c *Context) error { return nil })
+
+	for run := 0; run < 2; run++ {
+		before := polls.Load()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- b.StartLongPolling(ctx) }()
+		deadline := time.Now().Add(2 * time.Second)
+		for polls.Load() == before {
+			if time.Now().After(deadline) {
+				t.Fatalf("run %d: long polling did not poll", run)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("run %d: expected context.Canceled, got %v", run, err)
+		}
+	}
+
+	h, err := b.WebhookHandler(WebhookOptions{})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":1,"message":{"text":"hi"}}`))
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a new webhook handler to accept updates after shutdown, got %d", rec.Code)
+	}
+}
+
+func TestShutdownDrainsBackgroundWebhookQueue(t *testing.T) {
+	b := NewBot(&Client{})
+	var handled atomic.Int32
+	b.HandleText(func(c *Context) error {
+		time.Sleep(10 * time.Millisecond)
+		handled.Add(1)
+		return nil
+	})
+	h, err := b.WebhookHandler(WebhookOptions{HandleInBackground: true, BackgroundWorkers: 1})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":1,"message":{"chat":{"chat_id":1},"text":"hi"}}`))
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := b.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+	if handled.Load() != 3 {
+		t.Fatalf("expected 3 handled updates, got %d", handled.Load())
+	}
+	if got := b.ShutdownStats(); got.Drained != 3 || got.Aborted != 0 {
+		t.Fatalf("unexpected stats: %+v", got)
+	}
+}
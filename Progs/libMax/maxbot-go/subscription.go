@@ -0,0 +1,78 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrWebhookActive is returned by StartLongPolling when a webhook
+// subscription exists and PollingOptions.OnActiveWebhook is
+// ActiveWebhookRefuse.
+var ErrWebhookActive = errors.New("webhook subscription is active")
+
+// ActiveWebhookPolicy controls how StartLongPolling treats existing webhook
+// subscriptions, which make MAX stop delivering updates to polling.
+type ActiveWebhookPolicy int
+
+const (
+	// ActiveWebhookIgnore starts polling without checking subscriptions.
+	ActiveWebhookIgnore ActiveWebhookPolicy = iota
+	// ActiveWebhookRefuse fails with ErrWebhookActive.
+	ActiveWebhookRefuse
+	// ActiveWebhookRemove deletes every subscription before polling.
+	ActiveWebhookRemove
+)
+
+func (b *Bot) checkActiveWebhook(ctx context.Context) error {
+	if b.polling.OnActiveWebhook == ActiveWebhookIgnore {
+		return nil
+	}
+	subs, err := b.client.GetSubscriptions(ctx)
+	if err != nil {
+		b.logger.Errorf("long polling list subscriptions failed: %v", err)
+		return fmt.Errorf("list subscriptions: %w", err)
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	if b.polling.OnActiveWebhook == ActiveWebhookRefuse {
+		b.logger.Errorf("long polling refused: webhook subscription %s is active", subs[0].URL)
+		return fmt.Errorf("%w: %s", ErrWebhookActive, subs[0].URL)
+	}
+	for _, sub := range subs {
+		if err := b.client.Unsubscribe(ctx, sub.URL); err != nil {
+			b.logger.Errorf("long polling remove subscription %s failed: %v", sub.URL, err)
+			return fmt.Errorf("remove subscription %s: %w", sub.URL, err)
+		}
+		b.logger.Infof("long polling removed webhook subscription %s", sub.URL)
+	}
+	return nil
+}
+
+func (b *Bot) subscribeWebhook(ctx context.Context, opts WebhookOptions) (string, error) {
+	publicURL := strings.TrimSpace(opts.PublicURL)
+	if publicURL == "" {
+		return "", nil
+	}
+	err := b.client.Subscribe(ctx, SubscribeRequest{
+		URL:         publicURL,
+		UpdateTypes: opts.UpdateTypes,
+		Secret:      strings.TrimSpace(opts.Secret),
+	})
+	if err != nil {
+		b.logger.Errorf("webhook subscribe %s failed: %v", publicURL, err)
+		return "", fmt.Errorf("webhook subscribe: %w", err)
+	}
+	b.logger.Infof("webhook subscribed %s", publicURL)
+	return publicURL, nil
+}
+
+func (b *Bot) unsubscribeWebhook(ctx context.Context, publicURL string) {
+	if err := b.client.Unsubscribe(ctx, publicURL); err != nil {
+		b.logger.Errorf("webhook unsubscribe %s failed: %v", publicURL, err)
+		return
+	}
+	b.logger.Infof("webhook unsubscribed %s", publicURL)
+}
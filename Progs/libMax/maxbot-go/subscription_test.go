@@ -0,0 +1,182 @@
+package maxbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSubscriptionAPI struct {
+	mu      sync.Mutex
+	subs    []Subscription
+	secrets []string
+	deleted []string
+}
+
+func newFakeSubscriptionAPI(t *testing.T, subs ...Subscription) (*fakeSubscriptionAPI, *Client) {
+	t.Helper()
+	api := &fakeSubscriptionAPI{subs: subs}
+	c := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		switch {
+		case r.URL.Path == "/subscriptions" && r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]any{"subscriptions": api.subs})
+		case r.URL.Path == "/subscriptions" && r.Method == http.MethodPost:
+			var req SubscribeRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			api.subs = append(api.subs, Subscription{URL: req.URL, UpdateTypes: req.UpdateTypes})
+			api.secrets = append(api.secrets, req.Secret)
+			_, _ = w.Write([]byte(`{"success":true}`))
+		case r.URL.Path == "/subscriptions" && r.Method == http.MethodDelete:
+			u := r.URL.Query().Get("url")
+			api.deleted = append(api.deleted, u)
+			kept := api.subs[:0]
+			for _, s := range api.subs {
+				if s.URL != u {
+					kept = append(kept, s)
+				}
+			}
+			api.subs = kept
+			_, _ = w.Write([]byte(`{"success":true}`))
+		case r.URL.Path == "/updates":
+			_, _ = w.Write([]byte(`{"updates":[]}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}, ClientConfig{})
+	return api, c
+}
+
+func TestClientSubscriptionEndpoints(t *testing.T) {
+	api, c := newFakeSubscriptionAPI(t)
+	ctx := context.Background()
+
+	if err := c.Subscribe(ctx, SubscribeRequest{URL: "https://bot.example/hook", UpdateTypes: []string{"message_created"}, Secret: "s"}); err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	subs, err := c.GetSubscriptions(ctx)
+	if err != nil {
+		t.Fatalf("GetSubscriptions error: %v", err)
+	}
+	if len(subs) != 1 || subs[0].URL != "https://bot.example/hook" || subs[0].UpdateTypes[0] != "message_created" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+	if err := c.Unsubscribe(ctx, "https://bot.example/hook"); err != nil {
+		t.Fatalf("Unsubscribe error: %v", err)
+	}
+	if len(api.subs) != 0 || len(api.deleted) != 1 || api.deleted[0] != "https://bot.example/hook" {
+		t.Fatalf("expected subscription removed, got subs=%+v deleted=%v", api.subs, api.deleted)
+	}
+	if err := c.Subscribe(ctx, SubscribeRequest{}); err == nil {
+		t.Fatal("expected error for empty url")
+	}
+}
+
+func TestLongPollingRefusesActiveWebhook(t *testing.T) {
+	_, c := newFakeSubscriptionAPI(t, Subscription{URL: "https://bot.example/hook"})
+	b := NewBot(c, WithPolling(PollingOptions{OnActiveWebhook: ActiveWebhookRefuse}))
+
+	err := b.StartLongPolling(context.Background())
+	if !errors.Is(err, ErrWebhookActive) {
+		t.Fatalf("expected ErrWebhookActive, got %v", err)
+	}
+}
+
+func TestLongPollingRemovesActiveWebhook(t *testing.T) {
+	api, c := newFakeSubscriptionAPI(t, Subscription{URL: "https://a.example"}, Subscription{URL: "https://b.example"})
+	b := NewBot(c, WithPolling(PollingOptions{OnActiveWebhook: ActiveWebhookRemove, IdleDelay: time.Millisecond}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.StartLongPolling(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected polling to run until deadline, got %v", err)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.subs) != 0 || len(api.deleted) != 2 {
+		t.Fatalf("expected all subscriptions removed, got subs=%+v deleted=%v", api.subs, api.deleted)
+	}
+}
+
+type signalLogger struct {
+	NopLogger
+	match string
+	ch    chan struct{}
+}
+
+func (l *signalLogger) Infof(format string, args ...any) {
+	if strings.Contains(fmt.Sprintf(format, args...), l.match) {
+		select {
+		case l.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func TestStartWebhookManagesSubscription(t *testing.T) {
+	api, c := newFakeSubscriptionAPI(t)
+	listening := &signalLogger{match: "listening", ch: make(chan struct{}, 1)}
+	b := NewBot(c, WithLogger(listening))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.StartWebhook(ctx, WebhookOptions{
+			Addr:                  "127.0.0.1:0",
+			Secret:                "s3cret",
+			PublicURL:             "https://bot.example/hook",
+			UnsubscribeOnShutdown: true,
+		})
+	}()
+
+	select {
+	case <-listening.ch:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected webhook server to start")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("StartWebhook error: %v", err)
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.secrets) != 1 || api.secrets[0] != "s3cret" {
+		t.Fatalf("expected secret to be registered, got %q", api.secrets)
+	}
+	if len(api.deleted) != 1 || api.deleted[0] != "https://bot.example/hook" {
+		t.Fatalf("expected unsubscribe on shutdown, got %v", api.deleted)
+	}
+}
+
+func TestStartWebhookDoesNotSubscribeWhenListenFails(t *testing.T) {
+	api, c := newFakeSubscriptionAPI(t)
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer taken.Close()
+
+	b := NewBot(c)
+	err = b.StartWebhook(context.Background(), WebhookOptions{
+		Addr:      taken.Addr().String(),
+		PublicURL: "https://bot.example/hook",
+	})
+	if err == nil {
+		t.Fatal("expected listen error for a port in use")
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.subs) != 0 {
+		t.Fatalf("expected no subscription for a server that never started, got %+v", api.subs)
+	}
+}
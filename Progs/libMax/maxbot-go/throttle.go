@@ -0,0 +1,141 @@
+package maxbot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultThrottleCooldown = time.Second
+	// throttleBurstWindow is how close together 429s must be to lower the
+	// adaptive rate.
+	throttleBurstWindow = time.Minute
+	// throttleRecoverEvery is how long without 429s raises the rate by one
+	// throttleRecoverStep.
+	throttleRecoverEvery = 10 * time.Second
+	throttleRecoverStep  = 0.1
+	throttleMinFactor    = 0.1
+)
+
+// adaptiveThrottle reacts to 429 responses for the whole client: it pauses
+// all requests (or all sends to one chat) for the Retry-After period and,
+// after repeated 429s, halves the request rate, recovering slowly once the
+// API stops pushing back. 429s arriving during the cooldown of an earlier
+// one come from requests already in flight and count as the same episode,
+// so one burst of rejections halves the rate at most once.
+type adaptiveThrottle struct {
+	mu       sync.Mutex
+	until    time.Time
+	chats    map[string]time.Time
+	baseRPS  float64
+	factor   float64
+	last429  time.Time
+	episode  time.Time // end of the cooldown started by last429
+	adjusted time.Time
+	bucket   *tokenBucket
+}
+
+func newAdaptiveThrottle(baseRPS float64) *adaptiveThrottle {
+	if baseRPS <= 0 {
+		baseRPS = defaultRateLimitRPS
+	}
+	return &adaptiveThrottle{baseRPS: baseRPS, factor: 1, chats: make(map[string]time.Time)}
+}
+
+// wait blocks through active cooldowns for key and, while the rate is
+// lowered, through the adaptive bucket. It returns the bucket it took a
+// token from, if any, so the caller can refund it.
+func (t *adaptiveThrottle) wait(ctx context.Context, key string) (*tokenBucket, error) {
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		t.recover(now)
+		until := t.until
+		if chatUntil, ok := t.chats[key]; ok {
+			if !now.Before(chatUntil) {
+				delete(t.chats, key)
+			} else if chatUntil.After(until) {
+				until = chatUntil
+			}
+		}
+		bucket := t.bucket
+		t.mu.Unlock()
+
+		if !until.After(now) {
+			if bucket == nil {
+				return nil, nil
+			}
+			if err := bucket.wait(ctx); err != nil {
+				return nil, err
+			}
+			return bucket, nil
+		}
+		if err := sleepWithContext(ctx, until.Sub(now)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// observe429 records a 429 for a request scoped to key (empty for global).
+func (t *adaptiveThrottle) observe429(key string, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = defaultThrottleCooldown
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	until := now.Add(retryAfter)
+	if key == "" {
+		if until.After(t.until) {
+			t.until = until
+		}
+	} else if until.After(t.chats[key]) {
+		t.chats[key] = until
+	}
+
+	if now.Before(t.episode) {
+		return
+	}
+	if !t.last429.IsZero() && now.Sub(t.last429) < throttleBurstWindow {
+		t.setFactor(t.factor/2, now)
+	}
+	t.last429 = now
+	t.episode = until
+}
+
+// recover raises the factor one step per throttleRecoverEvery without 429s.
+func (t *adaptiveThrottle) recover(now time.Time) {
+	if t.factor >= 1 {
+		return
+	}
+	since := t.last429
+	if t.adjusted.After(since) {
+		since = t.adjusted
+	}
+	if now.Sub(since) >= throttleRecoverEvery {
+		t.setFactor(t.factor+throttleRecoverStep, now)
+	}
+}
+
+func (t *adaptiveThrottle) setFactor(f float64, now time.Time) {
+	if f < throttleMinFactor {
+		f = throttleMinFactor
+	}
+	if f >= 1 {
+		t.factor, t.bucket = 1, nil
+		t.adjusted = now
+		return
+	}
+	t.factor = f
+	t.adjusted = now
+	// A fresh bucket without burst paces requests at the lowered rate.
+	t.bucket = newTokenBucket(t.baseRPS*f, 1)
+}
+
+func (t *adaptiveThrottle) rate() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.baseRPS * t.factor
+}
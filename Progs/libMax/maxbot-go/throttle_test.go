@@ -0,0 +1,191 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient429PausesOtherRequests(t *testing.T) {
+	var calls atomic.Int32
+	limited := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"code":"too.many.requests"}`))
+			close(limited)
+			return
+		}
+		_, _ = w.Write([]byte(`{"updates":[]}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ClientConfig{Token: "test-token", BaseURL: ts.URL, RateLimitRPS: 1000, RateLimitBurst: 1000})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	ctx := context.Background()
+	var apiErr *APIError
+	if _, err := c.GetUpdates(ctx, GetUpdatesOptions{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 error, got %v", err)
+	}
+	<-limited
+
+	start := time.Now()
+	if _, err := c.GetUpdates(ctx, GetUpdatesOptions{}); err != nil {
+		t.Fatalf("GetUpdates error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("expected request to wait for the cooldown, took %v", elapsed)
+	}
+}
+
+func TestThrottleChatCooldownIsScoped(t *testing.T) {
+	th := newAdaptiveThrottle(30)
+	th.observe429("1", 100*time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := th.wait(ctx, "2"); err != nil {
+		t.Fatalf("wait error: %v", err)
+	}
+	if _, err := th.wait(ctx, ""); err != nil {
+		t.Fatalf("wait error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("other chats should not wait, took %v", elapsed)
+	}
+	if _, err := th.wait(ctx, "1"); err != nil {
+		t.Fatalf("wait error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected chat 1 to wait for its cooldown, took %v", elapsed)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	th.observe429("", time.Second)
+	if _, err := th.wait(short, "2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected global cooldown to apply, got %v", err)
+	}
+}
+
+func TestThrottleLowersRateAndRecovers(t *testing.T) {
+	th := newAdaptiveThrottle(20)
+	th.observe429("", time.Millisecond)
+	if got := th.rate(); got != 20 {
+		t.Fatalf("single 429 should not lower the rate, got %v", got)
+	}
+	time.Sleep(2 * time.Millisecond)
+	th.observe429("", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	th.observe429("", time.Millisecond)
+	if got := th.rate(); got != 5 {
+		t.Fatalf("expected rate 5 after repeated 429s, got %v", got)
+	}
+
+	// Pretend the last 429 was long ago; each wait recovers one step.
+	th.mu.Lock()
+	past := time.Now().Add(-throttleRecoverEvery)
+	th.last429, th.adjusted = past, past
+	th.mu.Unlock()
+	if _, err := th.wait(context.Background(), ""); err != nil {
+		t.Fatalf("wait error: %v", err)
+	}
+	if got := th.rate(); got != 7 {
+		t.Fatalf("expected one recovery step to 7 rps, got %v", got)
+	}
+	if _, err := th.wait(context.Background(), ""); err != nil {
+		t.Fatalf("wait error: %v", err)
+	}
+	if got := th.rate(); got != 7 {
+		t.Fatalf("recovery should be gradual, got %v", got)
+	}
+}
+
+func TestThrottleHalvesOncePerBurstOf429s(t *testing.T) {
+	th := newAdaptiveThrottle(20)
+	burst := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				th.observe429("", 20*time.Millisecond)
+			}()
+		}
+		wg.Wait()
+	}
+
+	burst()
+	if got := th.rate(); got != 20 {
+		t.Fatalf("one burst of in-flight 429s should not lower the rate, got %v", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	burst()
+	if got := th.rate(); got != 10 {
+		t.Fatalf("expected one halving for the second burst, got %v", got)
+	}
+}
+
+// failingLimiter rejects every wait with a cancelled context.
+type failingLimiter struct{}
+
+func (failingLimiter) Wait(context.Context, string) error { return context.Canceled }
+
+func TestClientRefundsThrottleTokenWhenLimiterWaitFails(t *testing.T) {
+	c, err := NewClient(ClientConfig{Token: "test-token", BaseURL: "http://example.invalid", RateLimiter: failingLimiter{}})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	c.throttle.mu.Lock()
+	c.throttle.setFactor(0.5, time.Now())
+	bucket := c.throttle.bucket
+	c.throttle.mu.Unlock()
+
+	if _, err := c.waitAndAttempt(context.Background(), "", http.MethodGet, "/me", nil, "", "", 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected limiter error, got %v", err)
+	}
+	bucket.mu.Lock()
+	tokens := bucket.tokens
+	bucket.mu.Unlock()
+	if tokens < 1 {
+		t.Fatalf("expected the throttle token to be refunded, bucket has %v", tokens)
+	}
+}
+
+func TestClientThrottleFollowsConfiguredLimiter(t *testing.T) {
+	c, err := NewClient(ClientConfig{Token: "test-token", BaseURL: "http://example.invalid", RateLimitRPS: -1})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	if c.throttle != nil {
+		t.Fatal("expected negative RateLimitRPS to disable the adaptive throttle")
+	}
+
+	c, err = NewClient(ClientConfig{
+		Token:       "test-token",
+		BaseURL:     "http://example.invalid",
+		RateLimiter: NewRateLimiter(RateLimitConfig{RPS: 8}),
+	})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	if got := c.throttle.rate(); got != 8 {
+		t.Fatalf("expected throttle base rate from the custom limiter, got %v", got)
+	}
+
+	c, err = NewClient(ClientConfig{Token: "test-token", BaseURL: "http://example.invalid", RateLimiter: &recordingLimiter{}})
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	if got := c.throttle.rate(); got != defaultRateLimitRPS {
+		t.Fatalf("expected default base rate for a limiter without RPS, got %v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DispatchTimeoutError is returned by Dispatch when a handler does not
+// finish within its timeout. It matches context.DeadlineExceeded with
+// errors.Is.
+type DispatchTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *DispatchTimeoutError) Error() string {
+	return fmt.Sprintf("dispatch handler timed out after %s", e.Timeout)
+}
+
+func (e *DispatchTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// WithHandlerTimeout limits every dispatch to d, including middlewares.
+// See Router.SetHandlerTimeout.
+func WithHandlerTimeout(d time.Duration) BotOption {
+	return func(b *Bot) {
+		b.router.SetHandlerTimeout(d)
+	}
+}
+
+// SetHandlerTimeout limits every dispatch to d (no limit when d <= 0). When
+// the limit is hit, the handler's context is cancelled and Dispatch returns
+// a *DispatchTimeoutError without waiting for the handler to return, so the
+// polling loop or worker can move on.
+func (r *Router) SetHandlerTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+// HandlerTimeout overrides the dispatch timeout for one handler. The new
+// limit counts from the moment the handler is entered and may be longer or
+// shorter than the router-wide one.
+func HandlerTimeout(d time.Duration, h Handler) Handler {
+	return func(c *Context) error {
+		if d <= 0 {
+			return h(c)
+		}
+		if c.timer == nil {
+			return runWithTimeout(c, d, h)
+		}
+		if !c.timer.reset(d) {
+			return &DispatchTimeoutError{Timeout: c.timer.limit()}
+		}
+		ctx, cancel := context.WithDeadline(c.timer.parent, c.timer.deadlineAt())
+		defer cancel()
+		inner := *c
+		inner.ctx = ctx
+		return h(&inner)
+	}
+}
+
+// runWithTimeout runs h in its own goroutine and returns when it finishes or
+// its timer fires, whichever comes first.
+func runWithTimeout(c *Context, d time.Duration, h Handler) error {
+	t := newHandlerTimer(c.ctx, d)
+	defer t.stop()
+
+	// The handler context expires on its own deadline, so the handler sees
+	// context.DeadlineExceeded rather than a cancellation.
+	ctx, cancel := context.WithDeadline(t.parent, t.deadlineAt())
+	inner := *c
+	inner.ctx = ctx
+	inner.timer = t
+
+	done := make(chan error, 1)
+	go func() {
+		defer cancel()
+		done <- h(&inner)
+	}()
+	select {
+	case err := <-done:
+		return handlerResult(err, t)
+	case <-t.expired:
+		// Prefer the handler's own result if it finished at the same time.
+		select {
+		case err := <-done:
+			return handlerResult(err, t)
+		default:
+			return &DispatchTimeoutError{Timeout: t.limit()}
+		}
+	}
+}
+
+// handlerResult reports a handler that gave up because of its deadline as
+// timed out and returns any other result unchanged.
+func handlerResult(err error, t *handlerTimer) error {
+	if errors.Is(err, context.DeadlineExceeded) && !time.Now().Before(t.deadlineAt()) {
+		return &DispatchTimeoutError{Timeout: t.limit()}
+	}
+	return err
+}
+
+// handlerTimer is a resettable dispatch deadline. HandlerTimeout resets it
+// from inside the middleware chain once the final handler is known.
+type handlerTimer struct {
+	parent  context.Context
+	expired chan struct{}
+
+	mu       sync.Mutex
+	d        time.Duration
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newHandlerTimer(parent context.Context, d time.Duration) *handlerTimer {
+	if parent == nil {
+		parent = context.Background()
+	}
+	t := &handlerTimer{parent: parent, expired: make(chan struct{}), d: d, deadline: time.Now().Add(d)}
+	t.timer = time.AfterFunc(d, func() {
+		close(t.expired)
+	})
+	return t
+}
+
+// reset restarts the timer with d and reports false if it already fired.
+func (t *handlerTimer) reset(d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.timer.Stop() {
+		return false
+	}
+	t.d = d
+	t.deadline = time.Now().Add(d)
+	t.timer.Reset(d)
+	return true
+}
+
+func (t *handlerTimer) deadlineAt() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deadline
+}
+
+func (t *handlerTimer) limit() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.d
+}
+
+func (t *handlerTimer) stop() {
+	t.timer.Stop()
+}
@@ -0,0 +1,177 @@
+package maxbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatchTimeoutReturnsTypedError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRouter()
+	r.SetHandlerTimeout(20 * time.Millisecond)
+	cancelled := make(chan struct{})
+	r.HandleText(func(c *Context) error {
+		<-c.Context().Done()
+		if !errors.Is(c.Context().Err(), context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", c.Context().Err())
+		}
+		close(cancelled)
+		<-ctx.Done() // ignores its own cancellation until the test ends
+		return nil
+	})
+
+	start := time.Now()
+	err := r.Dispatch(context.Background(), nil, Update{Message: &Message{Text: "hi"}})
+	var timeoutErr *DispatchTimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout != 20*time.Millisecond {
+		t.Fatalf("expected DispatchTimeoutError, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected error to match context.DeadlineExceeded")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("dispatch waited for the hung handler")
+	}
+	<-cancelled
+}
+
+func TestHandlerTimeoutOverridesRouterTimeout(t *testing.T) {
+	r := NewRouter()
+	r.SetHandlerTimeout(20 * time.Millisecond)
+	r.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return next(c)
+		}
+	})
+	r.HandleCommand("slow", HandlerTimeout(time.Second, func(c *Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return nil
+		case <-c.Context().Done():
+			return c.Context().Err()
+		}
+	}))
+	if err := r.Dispatch(context.Background(), nil, Update{Message: &Message{Text: "/slow"}}); err != nil {
+		t.Fatalf("expected longer per-handler timeout to apply, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r = NewRouter()
+	r.HandleText(HandlerTimeout(20*time.Millisecond, func(c *Context) error {
+		<-ctx.Done()
+		return nil
+	}))
+	var timeoutErr *DispatchTimeoutError
+	err := r.Dispatch(context.Background(), nil, Update{Message: &Message{Text: "hi"}})
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout != 20*time.Millisecond {
+		t.Fatalf("expected per-handler timeout without router timeout, got %v", err)
+	}
+}
+
+func TestLongPollingReportsTimeoutAndKeepsPolling(t *testing.T) {
+	c := newPollingTestClient(t, `{"updates":[{"update_id":1,"message":{"text":"/hang"}},{"update_id":2,"message":{"text":"/next"}}]}`)
+	b := NewBot(c, WithHandlerTimeout(20*time.Millisecond))
+	b.HandleCommand("hang", func(c *Context) error {
+		<-c.Context().Done()
+		return c.Context().Err()
+	})
+	next := make(chan struct{})
+	b.HandleCommand("next", func(c *Context) error {
+		close(next)
+		return nil
+	})
+	reported := make(chan error, 1)
+	b.OnError(func(err error, upd Update) { reported <- err })
+
+	done := make(chan error, 1)
+	go func() { done <- b.StartLongPolling(context.Background()) }()
+
+	select {
+	case <-next:
+	case err := <-done:
+		t.Fatalf("expected polling to continue after a timeout, stopped with %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("hung handler blocked long polling")
+	}
+	var timeoutErr *DispatchTimeoutError
+	if err := <-reported; !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected DispatchTimeoutError to be reported, got %v", err)
+	}
+
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("expected nil after Shutdown, got %v", err)
+	}
+}
+
+func TestDispatchTimeoutKeepsResultOfFinishedHandler(t *testing.T) {
+	timer := newHandlerTimer(context.Background(), time.Millisecond)
+	defer timer.stop()
+	<-timer.expired
+
+	if err := handlerResult(nil, timer); err != nil {
+		t.Fatalf("expected a handler that finished to keep its nil result, got %v", err)
+	}
+	boom := errors.New("boom")
+	if err := handlerResult(boom, timer); err != boom {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	var timeoutErr *DispatchTimeoutError
+	if err := handlerResult(context.DeadlineExceeded, timer); !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a handler that gave up on its deadline to time out, got %v", err)
+	}
+}
+
+func TestBackgroundWorkerFreedAfterTimeout(t *testing.T) {
+	b := NewBot(&Client{}, WithHandlerTimeout(20*time.Millisecond))
+	handled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.HandleCommand("hang", func(c *Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	b.HandleText(func(c *Context) error {
+		close(handled)
+		return nil
+	})
+	reported := make(chan error, 2)
+	h, err := b.WebhookHandler(WebhookOptions{
+		HandleInBackground: true,
+		BackgroundWorkers:  1,
+		OnDispatchError:    func(err error, upd Update) { reported <- err },
+	})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+	for _, body := range []string{
+		`{"update_id":1,"message":{"text":"/hang","chat":{"chat_id":1}}}`,
+		`{"update_id":2,"message":{"text":"ok","chat":{"chat_id":1}}}`,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+	}
+
+	select {
+	case <-handled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker slot was not freed after timeout")
+	}
+	var timeoutErr *DispatchTimeoutError
+	if err := <-reported; !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected DispatchTimeoutError, got %v", err)
+	}
+}
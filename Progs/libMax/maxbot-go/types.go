@@ -47,9 +47,16 @@ type User struct {
 }
 
 type Chat struct {
-	ID    ID     `json:"chat_id"`
-	Title string `json:"title,omitempty"`
-	Type  string `json:"type,omitempty"`
+	ID                ID     `json:"chat_id"`
+	Title             string `json:"title,omitempty"`
+	Type              string `json:"type,omitempty"`
+	Status            string `json:"status,omitempty"`
+	Description       string `json:"description,omitempty"`
+	Link              string `json:"link,omitempty"`
+	OwnerID           ID     `json:"owner_id,omitempty"`
+	ParticipantsCount int    `json:"participants_count,omitempty"`
+	IsPublic          bool   `json:"is_public,omitempty"`
+	LastEventTime     int64  `json:"last_event_time,omitempty"`
 }
 
 type Message struct {
@@ -88,8 +95,35 @@ func (m *Message) Command() string {
 }
 
 type SendMessageRequest struct {
-	ChatID ID     `json:"chat_id"`
-	Text   string `json:"text"`
+	ChatID      ID                    `json:"chat_id"`
+	Text        string                `json:"text"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+	// IdempotencyKey identifies the logical send; a random key is used
+	// when empty.
+	IdempotencyKey string `json:"-"`
+}
+
+type EditMessageTextRequest struct {
+	ChatID      ID                    `json:"chat_id"`
+	MessageID   ID                    `json:"message_id"`
+	Text        string                `json:"text"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type AnswerCallbackQueryRequest struct {
+	CallbackID string `json:"callback_id"`
+	Text       string `json:"text,omitempty"`
+	ShowAlert  bool   `json:"show_alert,omitempty"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
 }
 
 type UploadMediaRequest struct {
@@ -109,4 +143,21 @@ type SendMediaRequest struct {
 	MediaID ID     `json:"media_id"`
 	Caption string `json:"caption,omitempty"`
 	Type    string `json:"type,omitempty"`
+	// IdempotencyKey identifies the logical send; a random key is used
+	// when empty.
+	IdempotencyKey string `json:"-"`
+}
+
+type Subscription struct {
+	URL         string   `json:"url"`
+	Time        int64    `json:"time,omitempty"`
+	UpdateTypes []string `json:"update_types,omitempty"`
+	Version     string   `json:"version,omitempty"`
+}
+
+type SubscribeRequest struct {
+	URL         string   `json:"url"`
+	UpdateTypes []string `json:"update_types,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
 }
@@ -0,0 +1,129 @@
+package maxbot
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// WebhookSecretHeader is the header MAX uses to deliver the subscription secret.
+const WebhookSecretHeader = "X-Max-Bot-Api-Secret"
+
+type webhookAuth struct {
+	secret         []byte
+	allowed        []netip.Prefix
+	trustedProxies []netip.Prefix
+	logger         Logger
+}
+
+func newWebhookAuth(opts WebhookOptions, logger Logger) (*webhookAuth, error) {
+	allowed, err := parsePrefixes(opts.AllowedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("webhook allowed ips: %w", err)
+	}
+	trusted, err := parsePrefixes(opts.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("webhook trusted proxies: %w", err)
+	}
+	a := &webhookAuth{
+		allowed:        allowed,
+		trustedProxies: trusted,
+		logger:         logger,
+	}
+	if secret := strings.TrimSpace(opts.Secret); secret != "" {
+		a.secret = []byte(secret)
+	}
+	return a, nil
+}
+
+func (a *webhookAuth) wrap(next http.Handler) http.Handler {
+	if len(a.secret) == 0 && len(a.allowed) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(a.allowed) > 0 {
+			ip, ok := a.clientIP(r)
+			if !ok || !containsAddr(a.allowed, ip) {
+				a.logger.Errorf("webhook rejected request from %s: address not allowed", r.RemoteAddr)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		if len(a.secret) > 0 {
+			got := []byte(r.Header.Get(WebhookSecretHeader))
+			if subtle.ConstantTimeCompare(got, a.secret) != 1 {
+				a.logger.Errorf("webhook rejected request from %s: invalid secret", r.RemoteAddr)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the peer address, or the right-most untrusted
+// X-Forwarded-For hop when the peer is a trusted proxy.
+func (a *webhookAuth) clientIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	ip = ip.Unmap()
+	if !containsAddr(a.trustedProxies, ip) {
+		return ip, true
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		hop = hop.Unmap()
+		if !containsAddr(a.trustedProxies, hop) {
+			return hop, true
+		}
+	}
+	return ip, true
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, err
+		}
+		ip = ip.Unmap()
+		out = append(out, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+	return out, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package maxbot
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func authHandler(t *testing.T, opts WebhookOptions, logger Logger) (http.Handler, *bool) {
+	t.Helper()
+	auth, err := newWebhookAuth(opts, logger)
+	if err != nil {
+		t.Fatalf("newWebhookAuth error: %v", err)
+	}
+	called := false
+	return auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})), &called
+}
+
+func TestWebhookSecretVerification(t *testing.T) {
+	var out bytes.Buffer
+	h, called := authHandler(t, WebhookOptions{Secret: "s3cret"}, NewStdLogger(log.New(&out, "", 0)))
+
+	cases := []struct {
+		header string
+		want   int
+	}{
+		{header: "", want: http.StatusUnauthorized},
+		{header: "wrong", want: http.StatusUnauthorized},
+		{header: "s3cret", want: http.StatusOK},
+	}
+	for _, tc := range cases {
+		*called = false
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{}"))
+		if tc.header != "" {
+			req.Header.Set(WebhookSecretHeader, tc.header)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Fatalf("secret %q: expected %d, got %d", tc.header, tc.want, rr.Code)
+		}
+		if *called != (tc.want == http.StatusOK) {
+			t.Fatalf("secret %q: unexpected handler call state %v", tc.header, *called)
+		}
+	}
+	if !strings.Contains(out.String(), "invalid secret") {
+		t.Fatalf("expected rejection to be logged, got %q", out.String())
+	}
+}
+
+func TestWebhookAllowedIPs(t *testing.T) {
+	h, _ := authHandler(t, WebhookOptions{
+		AllowedIPs:     []string{"203.0.113.0/24", "2001:db8::1"},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}, NopLogger{})
+
+	cases := []struct {
+		name   string
+		remote string
+		xff    string
+		want   int
+	}{
+		{name: "direct allowed", remote: "203.0.113.7:4000", want: http.StatusOK},
+		{name: "direct ipv6 allowed", remote: "[2001:db8::1]:4000", want: http.StatusOK},
+		{name: "direct denied", remote: "198.51.100.1:4000", want: http.StatusForbidden},
+		{name: "untrusted xff ignored", remote: "198.51.100.1:4000", xff: "203.0.113.7", want: http.StatusForbidden},
+		{name: "trusted proxy allowed", remote: "10.1.2.3:4000", xff: "198.51.100.1, 203.0.113.7", want: http.StatusOK},
+		{name: "trusted proxy chain", remote: "10.1.2.3:4000", xff: "203.0.113.7, 10.9.9.9", want: http.StatusOK},
+		{name: "trusted proxy denied", remote: "10.1.2.3:4000", xff: "203.0.113.7, 198.51.100.1", want: http.StatusForbidden},
+		{name: "bad xff", remote: "10.1.2.3:4000", xff: "garbage", want: http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{}"))
+		req.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, rr.Code)
+		}
+	}
+}
+
+func TestWebhookAuthRejectsInvalidRanges(t *testing.T) {
+	if _, err := newWebhookAuth(WebhookOptions{AllowedIPs: []string{"not-an-ip"}}, NopLogger{}); err == nil {
+		t.Fatal("expected error for invalid allowed ip")
+	}
+	if _, err := newWebhookAuth(WebhookOptions{TrustedProxies: []string{"10.0.0.0/99"}}, NopLogger{}); err == nil {
+		t.Fatal("expected error for invalid trusted proxy")
+	}
+}
@@ -1,16 +1,19 @@
 package maxbot
 
 import (
+	"context"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"strings"
 	"testing"
 )
 
 func TestWebhookMethodNotAllowed(t *testing.T) {
 	b := NewBot(&Client{})
-	h := b.webhookHandler()
+	h := b.webhookHandler(b.beginRun(), defaultWebhookMaxBodyBytes, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/webhook", nil)
 	rr := httptest.NewRecorder()
@@ -23,7 +26,7 @@ func TestWebhookMethodNotAllowed(t *testing.T) {
 
 func TestWebhookInvalidPayload(t *testing.T) {
 	b := NewBot(&Client{})
-	h := b.webhookHandler()
+	h := b.webhookHandler(b.beginRun(), defaultWebhookMaxBodyBytes, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{"))
 	rr := httptest.NewRecorder()
@@ -41,7 +44,7 @@ func TestWebhookDispatchesUpdate(t *testing.T) {
 		called = true
 		return nil
 	})
-	h := b.webhookHandler()
+	h := b.webhookHandler(b.beginRun(), defaultWebhookMaxBodyBytes, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":1,"message":{"text":"/start"}}`))
 	rr := httptest.NewRecorder()
@@ -60,7 +63,7 @@ func TestWebhookReturns500OnHandlerError(t *testing.T) {
 	b.HandleText(func(c *Context) error {
 		return errors.New("boom")
 	})
-	h := b.webhookHandler()
+	h := b.webhookHandler(b.beginRun(), defaultWebhookMaxBodyBytes, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":1,"message":{"text":"hello"}}`))
 	rr := httptest.NewRecorder()
@@ -70,3 +73,173 @@ func TestWebhookReturns500OnHandlerError(t *testing.T) {
 		t.Fatalf("expected 500, got %d", rr.Code)
 	}
 }
+
+func TestWebhookHandlerMountsIntoExistingMux(t *testing.T) {
+	b := NewBot(&Client{})
+	called := false
+	b.HandleText(func(c *Context) error {
+		called = true
+		return nil
+	})
+	h, err := b.WebhookHandler(WebhookOptions{Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.Handle("/hooks/max", h)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("healthz error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected healthz 200, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/hooks/max", strings.NewReader(`{"update_id":1,"message":{"text":"hi"}}`))
+	req.Header.Set(WebhookSecretHeader, "s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("webhook error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected webhook 200, got %d", resp.StatusCode)
+	}
+	if !called {
+		t.Fatal("expected handler to be called")
+	}
+}
+
+func TestWebhookHandlerRejectsOversizedPayload(t *testing.T) {
+	b := NewBot(&Client{})
+	h, err := b.WebhookHandler(WebhookOptions{MaxBodyBytes: 16})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":1,"message":{"text":"hello world"}}`))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", rr.Code)
+	}
+}
+
+func TestWebhookHandlerRequiresClient(t *testing.T) {
+	if _, err := NewBot(nil).WebhookHandler(WebhookOptions{}); err == nil {
+		t.Fatal("expected error for nil client")
+	}
+}
+
+func TestWebhookBackgroundAcknowledgesBeforeDispatch(t *testing.T) {
+	b := NewBot(&Client{})
+	release := make(chan struct{})
+	handled := make(chan string, 2)
+	b.HandleText(func(c *Context) error {
+		<-release
+		handled <- c.MessageText()
+		return nil
+	})
+	var gotErr error
+	h, err := b.WebhookHandler(WebhookOptions{
+		HandleInBackground: true,
+		OnDispatchError:    func(err error, upd Update) { gotErr = err },
+	})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":1,"message":{"chat":{"chat_id":1},"text":"slow"}}`))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected immediate 200, got %d", rr.Code)
+	}
+	select {
+	case <-handled:
+		t.Fatal("expected dispatch to run after acknowledgement")
+	default:
+	}
+
+	close(release)
+	if err := b.DrainWebhook(context.Background()); err != nil {
+		t.Fatalf("DrainWebhook error: %v", err)
+	}
+	if got := <-handled; got != "slow" {
+		t.Fatalf("unexpected handled update: %q", got)
+	}
+	if gotErr != nil {
+		t.Fatalf("unexpected dispatch error: %v", gotErr)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":2,"message":{"text":"late"}}`)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 after drain, got %d", rr.Code)
+	}
+}
+
+func TestWebhookBackgroundReportsDispatchErrors(t *testing.T) {
+	b := NewBot(&Client{})
+	b.HandleText(func(c *Context) error {
+		return errors.New("boom")
+	})
+	errCh := make(chan error, 1)
+	h, err := b.WebhookHandler(WebhookOptions{
+		HandleInBackground: true,
+		OnDispatchError:    func(err error, upd Update) { errCh <- err },
+	})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":1,"message":{"text":"x"}}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if err := b.DrainWebhook(context.Background()); err != nil {
+		t.Fatalf("DrainWebhook error: %v", err)
+	}
+	if err := <-errCh; err == nil || err.Error() != "boom" {
+		t.Fatalf("expected boom error, got %v", err)
+	}
+}
+
+func TestStartWebhookStartsNoWorkersWhenListenFails(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer taken.Close()
+
+	b := NewBot(&Client{})
+	before := runtime.NumGoroutine()
+	err = b.StartWebhook(context.Background(), WebhookOptions{
+		Addr:               taken.Addr().String(),
+		HandleInBackground: true,
+		BackgroundWorkers:  32,
+	})
+	if err == nil {
+		t.Fatal("expected listen error for a port in use")
+	}
+
+	b.poolsMu.Lock()
+	pools := len(b.pools)
+	b.poolsMu.Unlock()
+	if pools != 0 {
+		t.Fatalf("expected no registered worker pools, got %d", pools)
+	}
+	if after := runtime.NumGoroutine(); after-before >= 32 {
+		t.Fatalf("expected no background workers left, goroutines went from %d to %d", before, after)
+	}
+}
@@ -0,0 +1,178 @@
+package maxbot
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestKeyPair(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	cert, err := selfSignedCertificate("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("selfSignedCertificate error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse cert: %v", err)
+	}
+	return certFile, keyFile, leaf
+}
+
+func TestWebhookServesOverTLSFromCertFiles(t *testing.T) {
+	certFile, keyFile, leaf := writeTestKeyPair(t, t.TempDir())
+	cfg, err := webhookTLSConfig(WebhookOptions{TLSCertFile: certFile, TLSKeyFile: keyFile}, NopLogger{})
+	if err != nil {
+		t.Fatalf("webhookTLSConfig error: %v", err)
+	}
+
+	b := NewBot(&Client{})
+	called := false
+	b.HandleText(func(c *Context) error {
+		called = true
+		return nil
+	})
+	h, err := b.WebhookHandler(WebhookOptions{})
+	if err != nil {
+		t.Fatalf("WebhookHandler error: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(h)
+	ts.Listener = tls.NewListener(ts.Listener, cfg)
+	ts.Start()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	url := strings.Replace(ts.URL, "http://", "https://", 1)
+	resp, err := client.Post(url, "application/json", strings.NewReader(`{"update_id":1,"message":{"text":"hi"}}`))
+	if err != nil {
+		t.Fatalf("tls request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp.TLS == nil || !called {
+		t.Fatalf("expected handler to be reached over tls (tls=%v called=%v)", resp.TLS != nil, called)
+	}
+}
+
+func TestCertReloaderPicksUpChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, first := writeTestKeyPair(t, dir)
+	r, err := newCertReloader(certFile, keyFile, NopLogger{})
+	if err != nil {
+		t.Fatalf("newCertReloader error: %v", err)
+	}
+
+	_, _, second := writeTestKeyPair(t, dir)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+	_ = os.Chtimes(keyFile, later, later)
+	r.lastCheck = time.Time{}
+
+	got, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate error: %v", err)
+	}
+	if string(got.Certificate[0]) == string(first.Raw) || string(got.Certificate[0]) != string(second.Raw) {
+		t.Fatal("expected reloaded certificate")
+	}
+
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	evenLater := later.Add(time.Minute)
+	_ = os.Chtimes(certFile, evenLater, evenLater)
+	r.lastCheck = time.Time{}
+	got, err = r.GetCertificate(nil)
+	if err != nil || string(got.Certificate[0]) != string(second.Raw) {
+		t.Fatal("expected previous certificate to be kept after failed reload")
+	}
+}
+
+func TestWebhookTLSConfigValidation(t *testing.T) {
+	cfg, err := webhookTLSConfig(WebhookOptions{}, NopLogger{})
+	if err != nil || cfg != nil {
+		t.Fatalf("expected no tls config, got %v, %v", cfg, err)
+	}
+	if _, err := webhookTLSConfig(WebhookOptions{TLSCertFile: "cert.pem"}, NopLogger{}); err == nil {
+		t.Fatal("expected error when key file is missing")
+	}
+	if _, err := webhookTLSConfig(WebhookOptions{TLSCertFile: "missing.pem", TLSKeyFile: "missing.key"}, NopLogger{}); err == nil {
+		t.Fatal("expected error for missing files")
+	}
+}
+
+func TestStartWebhookSelfSignedHTTP2(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	b := NewBot(&Client{})
+	b.HandleText(func(c *Context) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.StartWebhook(ctx, WebhookOptions{Addr: addr, Path: "/hook", SelfSignedTLS: true})
+	}()
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = client.Post("https://"+addr+"/hook", "application/json", strings.NewReader(`{"update_id":1,"message":{"text":"hi"}}`))
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("tls request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("StartWebhook error: %v", err)
+	}
+}